@@ -5,7 +5,10 @@ cd /mnt/onboard/.adds/notion_sync
 chmod +x sync.arm
 
 echo "Starting sync at $(date)" >> sync.log
-sync.arm >> sync.log 2>&1
-echo "Finished sync with exit code $?" >> sync.log
+sync.arm sync >> sync.log 2>&1
+status=$?
 
-exit 0
\ No newline at end of file
+# 0: synced, 1: failed, 2: invalid command, 3: invalid configuration, 4: some books will be retried
+echo "Finished sync with exit code $status" >> sync.log
+
+exit $status
@@ -0,0 +1,215 @@
+package cli
+
+/*
+Package cli implements the command line of the sync tool. Commands share the global
+flags, which come before the command name, and report failures through exit codes
+so start.sh and NickelMenu can react to them.
+*/
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"kobo-to-notion/config"
+	"kobo-to-notion/kobo"
+	"kobo-to-notion/logger"
+)
+
+// Exit codes of the commands
+const (
+	// ExitOK means the command succeeded
+	ExitOK = 0
+	// ExitError means the command failed
+	ExitError = 1
+	// ExitUsage means the command or its flags are invalid
+	ExitUsage = 2
+	// ExitConfig means the configuration is missing or invalid
+	ExitConfig = 3
+	// ExitPartial means some books could not be synced, they are retried on the next run
+	ExitPartial = 4
+)
+
+// DefaultLogPath is where logs are written when --log is not set
+const DefaultLogPath = "./logs/app.log"
+
+// Version of the build, set with -ldflags "-X kobo-to-notion/cli.Version=v1.2.3"
+var Version = "dev"
+
+// options holds the global flags and outputs shared by all commands
+type options struct {
+	configPath string
+	logPath    string
+	verbose    bool
+	quiet      bool
+
+	// printLogs is set when logs are printed besides the log file
+	printLogs bool
+
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command is a subcommand of the CLI
+type command struct {
+	name    string
+	summary string
+	run     func(opts *options, args []string) int
+}
+
+// commands returns the available commands, in the order they are listed in the usage
+func commands() []command {
+	return []command{
+		{"sync", "Sync highlights to Notion (default)", runSync},
+		{"export", "Export highlights as Markdown files", runExport},
+		{"status", "Show what changed since the last sync", runStatus},
+		{"doctor", "Check the configuration, Kobo database and Notion access", runDoctor},
+		{"setup", "Create the Notion database or add its missing properties", runSetup},
+		{"list-books", "List the books with highlights on the Kobo", runListBooks},
+		{"version", "Print the version", runVersion},
+	}
+}
+
+// Run parses the arguments, runs the selected command and returns its exit code
+func Run(args []string, stdout, stderr io.Writer) int {
+	opts := &options{stdout: stdout, stderr: stderr}
+
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.configPath, "config", config.DefaultEnvPath, "Path of the env file holding the configuration")
+	flags.StringVar(&opts.logPath, "log", DefaultLogPath, "Path of the log file")
+	flags.BoolVar(&opts.verbose, "verbose", false, "Log debug messages")
+	flags.BoolVar(&opts.verbose, "v", false, "Shorthand for --verbose")
+	flags.BoolVar(&opts.quiet, "quiet", false, "Only write logs to the log file")
+	flags.BoolVar(&opts.quiet, "q", false, "Shorthand for --quiet")
+	flags.Usage = func() { printUsage(stderr, flags) }
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	// Running without a command syncs, as releases before subcommands did
+	name := "sync"
+	rest := flags.Args()
+	if len(rest) > 0 {
+		name, rest = rest[0], rest[1:]
+	}
+
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd.run(opts, rest)
+		}
+	}
+
+	fmt.Fprintf(stderr, "Unknown command %q\n\n", name)
+	printUsage(stderr, flags)
+	return ExitUsage
+}
+
+// printUsage prints the commands and global flags
+func printUsage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: sync [global flags] <command> [command flags]")
+	fmt.Fprintln(w, "\nCommands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-12s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "\nGlobal flags:")
+	flags.PrintDefaults()
+	fmt.Fprintln(w, "\nRun 'sync <command> -h' for the flags of a command.")
+}
+
+// newFlagSet creates the flag set of a command
+func (o *options) newFlagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(o.stderr)
+	return flags
+}
+
+// parseFlags parses the flags of a command, returning the exit code to stop with if it fails
+func parseFlags(flags *flag.FlagSet, args []string) (int, bool) {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK, false
+		}
+		return ExitUsage, false
+	}
+
+	if flags.NArg() > 0 {
+		fmt.Fprintf(flags.Output(), "Unexpected arguments: %v\n", flags.Args())
+		return ExitUsage, false
+	}
+
+	return ExitOK, true
+}
+
+// initLogger opens the log file. Reporting commands print their own output,
+// so their logs only go to the log file unless --verbose is set.
+func (o *options) initLogger(report bool) error {
+	switch {
+	case o.verbose:
+		logger.SetLevel(logger.LevelVerbose)
+	case o.quiet || report:
+		logger.SetLevel(logger.LevelQuiet)
+	default:
+		logger.SetLevel(logger.LevelNormal)
+	}
+	o.printLogs = o.verbose || !(o.quiet || report)
+
+	if err := logger.Init(o.logPath); err != nil {
+		fmt.Fprintf(o.stderr, "Failed to initialize logger: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// loadConfig loads the env file and reads the configuration. A missing default
+// env file is not an error, the variables may come from the environment.
+func (o *options) loadConfig(requireNotion bool) (config.Config, error) {
+	err := config.LoadEnvFile(o.configPath)
+	if err != nil && !(errors.Is(err, fs.ErrNotExist) && o.configPath == config.DefaultEnvPath) {
+		return config.Config{}, fmt.Errorf("loading %s: %w", o.configPath, err)
+	}
+
+	if requireNotion {
+		return config.GetConfig()
+	}
+	return config.GetLocalConfig()
+}
+
+// getBookmarks reads the bookmarks of the synced types from the Kobo database, with the
+// reading progress and shelves of their books. Databases without them still sync highlights.
+func getBookmarks(appConfig config.Config) ([]kobo.Bookmark, error) {
+	bookmarks, err := kobo.GetBookmarks(appConfig.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	bookmarks = kobo.FilterTypes(bookmarks, appConfig.SyncTypes)
+
+	if stats, err := kobo.GetReadingStats(appConfig.DBPath); err != nil {
+		logger.Logger.Printf("Warning: could not read reading progress: %v\n", err)
+	} else {
+		kobo.ApplyReadingStats(bookmarks, stats)
+	}
+
+	if shelves, err := kobo.GetShelves(appConfig.DBPath); err != nil {
+		logger.Logger.Printf("Warning: could not read shelves: %v\n", err)
+	} else {
+		kobo.ApplyShelves(bookmarks, shelves)
+	}
+
+	return bookmarks, nil
+}
+
+// fail logs an error and prints it to stderr when logs are not printed, returning the exit code
+func (o *options) fail(code int, format string, v ...any) int {
+	message := fmt.Sprintf(format, v...)
+	logger.Logger.Println(message)
+	if !o.printLogs {
+		fmt.Fprintln(o.stderr, message)
+	}
+	return code
+}
@@ -0,0 +1,201 @@
+package cli
+
+import (
+	"bytes"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// setupEnv points the configuration at a test Kobo database and an empty env file
+func setupEnv(t *testing.T) (string, string) {
+	tempDir := t.TempDir()
+
+	dbPath := filepath.Join(tempDir, "KoboReader.sqlite")
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE Bookmark (
+			BookmarkID TEXT PRIMARY KEY,
+			VolumeID TEXT,
+			Text TEXT,
+			Annotation TEXT,
+			Type TEXT,
+			DateCreated TEXT,
+			DateModified TEXT,
+			Color TEXT,
+			ContentID TEXT,
+			StartContainerPath TEXT,
+			StartOffset INTEGER,
+			ChapterProgress REAL
+		);
+		CREATE TABLE content (
+			ContentID TEXT PRIMARY KEY,
+			Title TEXT,
+			Attribution TEXT,
+			Publisher TEXT,
+			ISBN TEXT,
+			Language TEXT,
+			Series TEXT,
+			VolumeIndex INTEGER
+		);
+		INSERT INTO Bookmark (BookmarkID, VolumeID, Text, Annotation, Type, DateCreated, Color) VALUES
+		('bm1', 'vol1', 'Sample text 1', NULL, 'highlight', '2023-01-02T12:00:00Z', '0'),
+		('bm2', 'vol1', 'Sample text 2', NULL, 'highlight', '2023-01-01T12:00:00Z', '1'),
+		('bm3', 'file:///mnt/onboard/Other Book.epub', 'Sample text 3', NULL, 'highlight', '2023-01-01T12:00:00Z', '2');
+		INSERT INTO content (ContentID, Title, Attribution) VALUES ('vol1', 'Sample Book', 'Jane Doe');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create test database: %v", err)
+	}
+
+	envPath := filepath.Join(tempDir, ".env")
+	if err := os.WriteFile(envPath, nil, 0644); err != nil {
+		t.Fatalf("Failed to create env file: %v", err)
+	}
+
+	t.Setenv("NOTION_TOKEN", "")
+	t.Setenv("NOTION_DATABASE_ID", "")
+	t.Setenv("KOBO_DB_PATH", dbPath)
+	t.Setenv("STATE_PATH", filepath.Join(tempDir, "sync_state.json"))
+	t.Setenv("EXPORT_PATH", filepath.Join(tempDir, "export"))
+
+	return tempDir, envPath
+}
+
+func run(t *testing.T, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := Run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRunVersion(t *testing.T) {
+	code, stdout, _ := run(t, "version")
+
+	if code != ExitOK {
+		t.Errorf("Expected exit code %d, got %d", ExitOK, code)
+	}
+	if !strings.Contains(stdout, Version) {
+		t.Errorf("Expected version %q in output, got %q", Version, stdout)
+	}
+}
+
+func TestRunUsageErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"Unknown command", []string{"unknown"}},
+		{"Unknown global flag", []string{"--unknown", "version"}},
+		{"Unknown command flag", []string{"version", "--unknown"}},
+		{"Unexpected argument", []string{"status", "extra"}},
+		{"Invalid plan format", []string{"sync", "--dry-run", "--plan-format", "xml"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, _, _ := run(t, test.args...)
+			if code != ExitUsage {
+				t.Errorf("Expected exit code %d, got %d", ExitUsage, code)
+			}
+		})
+	}
+}
+
+func TestRunSyncWithoutNotionConfig(t *testing.T) {
+	tempDir, envPath := setupEnv(t)
+
+	code, _, stderr := run(t, "--config", envPath, "--log", filepath.Join(tempDir, "app.log"), "--quiet", "sync")
+
+	if code != ExitConfig {
+		t.Errorf("Expected exit code %d, got %d", ExitConfig, code)
+	}
+	if !strings.Contains(stderr, "missing required environment variables") {
+		t.Errorf("Expected configuration error on stderr, got %q", stderr)
+	}
+}
+
+func TestRunMissingConfigFile(t *testing.T) {
+	tempDir, _ := setupEnv(t)
+
+	code, _, _ := run(t, "--config", filepath.Join(tempDir, "missing.env"), "--log", filepath.Join(tempDir, "app.log"), "list-books")
+
+	if code != ExitConfig {
+		t.Errorf("Expected exit code %d, got %d", ExitConfig, code)
+	}
+}
+
+func TestRunListBooks(t *testing.T) {
+	tempDir, envPath := setupEnv(t)
+
+	code, stdout, _ := run(t, "--config", envPath, "--log", filepath.Join(tempDir, "app.log"), "list-books")
+
+	if code != ExitOK {
+		t.Fatalf("Expected exit code %d, got %d", ExitOK, code)
+	}
+
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and 2 books, got %q", stdout)
+	}
+	if !strings.HasPrefix(lines[1], "Other Book") || !strings.HasSuffix(lines[1], "1") {
+		t.Errorf("Unexpected line for Other Book: %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "Jane Doe") || !strings.HasSuffix(lines[2], "2") {
+		t.Errorf("Unexpected line for Sample Book: %q", lines[2])
+	}
+}
+
+func TestRunStatus(t *testing.T) {
+	tempDir, envPath := setupEnv(t)
+
+	code, stdout, _ := run(t, "--config", envPath, "--log", filepath.Join(tempDir, "app.log"), "status")
+
+	if code != ExitOK {
+		t.Fatalf("Expected exit code %d, got %d", ExitOK, code)
+	}
+
+	for _, expected := range []string{"3 in 2 books", "Last sync:", "never", "Newest synced change:", "3 new or edited, 0 removed"} {
+		if !strings.Contains(stdout, expected) {
+			t.Errorf("Expected %q in status, got:\n%s", expected, stdout)
+		}
+	}
+}
+
+func TestRunExport(t *testing.T) {
+	tempDir, envPath := setupEnv(t)
+	exportPath := filepath.Join(tempDir, "vault")
+
+	code, _, _ := run(t, "--config", envPath, "--log", filepath.Join(tempDir, "app.log"), "--quiet", "export", "--path", exportPath)
+
+	if code != ExitOK {
+		t.Fatalf("Expected exit code %d, got %d", ExitOK, code)
+	}
+
+	for _, fileName := range []string{"Sample Book.md", "Other Book.md"} {
+		if _, err := os.Stat(filepath.Join(exportPath, fileName)); err != nil {
+			t.Errorf("Expected %s to be exported: %v", fileName, err)
+		}
+	}
+}
+
+func TestRunSetupWithoutNotionConfig(t *testing.T) {
+	tempDir, envPath := setupEnv(t)
+
+	code, _, stderr := run(t, "--config", envPath, "--log", filepath.Join(tempDir, "app.log"), "setup", "--parent", "parent-page")
+
+	if code != ExitConfig {
+		t.Errorf("Expected exit code %d, got %d", ExitConfig, code)
+	}
+	if !strings.Contains(stderr, "NOTION_TOKEN") {
+		t.Errorf("Expected missing token on stderr, got %q", stderr)
+	}
+}
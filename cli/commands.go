@@ -0,0 +1,503 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"kobo-to-notion/config"
+	"kobo-to-notion/kobo"
+	"kobo-to-notion/logger"
+	"kobo-to-notion/markdown"
+	"kobo-to-notion/notion"
+	"kobo-to-notion/state"
+	"kobo-to-notion/utils"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// runSync syncs the Kobo highlights to Notion, or prints the plan of the sync
+func runSync(opts *options, args []string) int {
+	flags := opts.newFlagSet("sync")
+	fullSync := flags.Bool("full", false, "Revisit every book instead of only those changed since the last sync")
+	dryRun := flags.Bool("dry-run", false, "Print the changes a sync would make without writing to Notion")
+	planFormat := flags.String("plan-format", "text", "Format of the dry run plan: text or json")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if *planFormat != "text" && *planFormat != "json" {
+		fmt.Fprintf(opts.stderr, "Invalid plan format %q, expected text or json\n", *planFormat)
+		return ExitUsage
+	}
+
+	if err := opts.initLogger(*dryRun); err != nil {
+		return ExitError
+	}
+	defer logger.Close()
+
+	appConfig, err := opts.loadConfig(true)
+	if err != nil {
+		return opts.fail(ExitConfig, "Error loading configuration: %v", err)
+	}
+
+	// Initialize Notion client
+	err = notion.InitializeNotionClient(appConfig.CertPath, appConfig.NotionToken, appConfig.DatabaseID)
+	if err != nil {
+		return opts.fail(ExitConfig, "Error initializing Notion client: %v", err)
+	}
+
+	if err := notion.SetProperties(appConfig.Properties); err != nil {
+		return opts.fail(ExitError, "Error setting property mapping: %v", err)
+	}
+
+	// Load the state of previous syncs
+	store, err := state.Load(appConfig.StatePath)
+	if err != nil {
+		return opts.fail(ExitError, "Error loading sync state: %v", err)
+	}
+
+	if err := notion.SetStateStore(store); err != nil {
+		return opts.fail(ExitError, "Error setting sync state: %v", err)
+	}
+
+	if err := notion.SetFullSync(*fullSync); err != nil {
+		return opts.fail(ExitError, "Error setting sync mode: %v", err)
+	}
+
+	if err := notion.SetSortOrder(appConfig.SortOrder); err != nil {
+		return opts.fail(ExitError, "Error setting sort order: %v", err)
+	}
+
+	if err := notion.SetBlockStyle(appConfig.BlockStyle); err != nil {
+		return opts.fail(ExitError, "Error setting block style: %v", err)
+	}
+
+	if err := notion.SetColorNames(appConfig.ColorNames); err != nil {
+		return opts.fail(ExitError, "Error setting colour names: %v", err)
+	}
+
+	if err := notion.SetDeletePolicy(appConfig.DeletePolicy, appConfig.DeleteAfterMissing, appConfig.DeleteMaxPercent); err != nil {
+		return opts.fail(ExitError, "Error setting delete policy: %v", err)
+	}
+
+	// Pages written to a database with missing or renamed properties are rejected or incomplete
+	issues, err := notion.ValidateNotionSchema(appConfig.DatabaseID, appConfig.SyncMode)
+	if err != nil {
+		return opts.fail(ExitError, "Error reading Notion database: %v", err)
+	}
+	if len(issues) > 0 {
+		return opts.fail(ExitConfig, "The Notion database does not match the %s sync mode: %s. Run 'sync setup' to fix it", appConfig.SyncMode, joinIssues(issues))
+	}
+	if err := notion.DropMissingOptionalProperties(appConfig.DatabaseID); err != nil {
+		return opts.fail(ExitError, "Error reading Notion database: %v", err)
+	}
+
+	// Fetch bookmarks from Kobo database
+	bookmarks, err := getBookmarks(appConfig)
+	if err != nil {
+		return opts.fail(ExitError, "Error retrieving highlights from database: %v", err)
+	}
+
+	// Books without highlights are mirrored from the library
+	if len(appConfig.LibraryStatuses) > 0 {
+		books, err := kobo.GetBooks(appConfig.DBPath)
+		if err != nil {
+			return opts.fail(ExitError, "Error retrieving books from database: %v", err)
+		}
+
+		filter := kobo.BookFilter{Statuses: appConfig.LibraryStatuses, Shelves: appConfig.LibraryShelves}
+		if err := notion.SetLibrary(books, filter); err != nil {
+			return opts.fail(ExitError, "Error setting library: %v", err)
+		}
+	}
+
+	if *dryRun {
+		return printPlan(opts, appConfig, bookmarks, *planFormat)
+	}
+
+	logger.Logger.Printf("Processing %d bookmarks in %s mode\n", len(bookmarks), appConfig.SyncMode)
+
+	switch appConfig.SyncMode {
+	case config.SyncModeFlat:
+		err = notion.AddBookmarksFlatToNotion(appConfig.DatabaseID, bookmarks)
+	default:
+		err = notion.AddBookmarksToNotion(appConfig.DatabaseID, bookmarks)
+	}
+
+	var partial *notion.PartialSyncError
+	var limit *notion.RemovalLimitError
+	switch {
+	case errors.As(err, &partial):
+		return opts.fail(ExitPartial, "Error adding bookmarks to Notion: %v", err)
+	case errors.As(err, &limit):
+		return opts.fail(ExitError, "Sync aborted, %v. Check that KOBO_DB_PATH is the right database, or raise DELETE_MAX_PERCENT", err)
+	case err != nil:
+		return opts.fail(ExitError, "Error adding bookmarks to Notion: %v", err)
+	}
+
+	return ExitOK
+}
+
+// printPlan prints the changes a sync would make without applying them
+func printPlan(opts *options, appConfig config.Config, bookmarks []kobo.Bookmark, planFormat string) int {
+	var plan *notion.Plan
+	var err error
+	switch appConfig.SyncMode {
+	case config.SyncModeFlat:
+		plan, err = notion.PlanBookmarksFlatInNotion(appConfig.DatabaseID, bookmarks)
+	default:
+		plan, err = notion.PlanBookmarksInNotion(appConfig.DatabaseID, bookmarks)
+	}
+	if err != nil {
+		return opts.fail(ExitError, "Error planning sync: %v", err)
+	}
+
+	if planFormat == "json" {
+		output, err := plan.JSON()
+		if err != nil {
+			return opts.fail(ExitError, "Error rendering plan: %v", err)
+		}
+		fmt.Fprintln(opts.stdout, string(output))
+		return ExitOK
+	}
+
+	fmt.Fprint(opts.stdout, plan.String())
+	return ExitOK
+}
+
+// runExport exports the Kobo highlights as Markdown files
+func runExport(opts *options, args []string) int {
+	flags := opts.newFlagSet("export")
+	path := flags.String("path", "", "Folder to export to, overriding EXPORT_PATH")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if err := opts.initLogger(false); err != nil {
+		return ExitError
+	}
+	defer logger.Close()
+
+	appConfig, err := opts.loadConfig(false)
+	if err != nil {
+		return opts.fail(ExitConfig, "Error loading configuration: %v", err)
+	}
+
+	exportPath := appConfig.ExportPath
+	if *path != "" {
+		exportPath = *path
+	}
+
+	bookmarks, err := getBookmarks(appConfig)
+	if err != nil {
+		return opts.fail(ExitError, "Error retrieving highlights from database: %v", err)
+	}
+
+	markupsPath := appConfig.MarkupsPath
+	if markupsPath == "" {
+		markupsPath = kobo.MarkupsDir(appConfig.DBPath)
+	}
+
+	options := markdown.ExportOptions{MarkupsDir: markupsPath, ColorNames: appConfig.ColorNames, SortOrder: appConfig.SortOrder}
+	if err := markdown.ExportBookmarksWithOptions(exportPath, bookmarks, options); err != nil {
+		return opts.fail(ExitError, "Error exporting highlights to Markdown: %v", err)
+	}
+
+	return ExitOK
+}
+
+// runStatus prints the last sync and the highlights changed since, without contacting Notion
+func runStatus(opts *options, args []string) int {
+	flags := opts.newFlagSet("status")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if err := opts.initLogger(true); err != nil {
+		return ExitError
+	}
+	defer logger.Close()
+
+	appConfig, err := opts.loadConfig(false)
+	if err != nil {
+		return opts.fail(ExitConfig, "Error loading configuration: %v", err)
+	}
+
+	bookmarks, err := getBookmarks(appConfig)
+	if err != nil {
+		return opts.fail(ExitError, "Error retrieving highlights from database: %v", err)
+	}
+
+	store, err := state.Load(appConfig.StatePath)
+	if err != nil {
+		return opts.fail(ExitError, "Error loading sync state: %v", err)
+	}
+
+	books := make(map[string]bool)
+	current := make(map[string]bool)
+	changed := 0
+	for _, bookmark := range bookmarks {
+		books[bookmark.VolumeID] = true
+		current[bookmark.BookmarkID] = true
+
+		entry, tracked := store.Get(bookmark.BookmarkID)
+		if !tracked || entry.Hash != utils.HashBookmark(bookmark) {
+			changed++
+		}
+	}
+
+	pages := make(map[string]bool)
+	removed := 0
+	for bookmarkID, entry := range store.Bookmarks {
+		pages[entry.PageID] = true
+		if !current[bookmarkID] {
+			removed++
+		}
+	}
+
+	lastSync := "never"
+	if !store.LastSync.IsZero() {
+		lastSync = store.LastSync.Local().Format(time.DateTime)
+	}
+
+	w := tabwriter.NewWriter(opts.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Kobo database:\t%s\n", appConfig.DBPath)
+	fmt.Fprintf(w, "Highlights:\t%d in %d books\n", len(bookmarks), len(books))
+	fmt.Fprintf(w, "Sync mode:\t%s\n", appConfig.SyncMode)
+	fmt.Fprintf(w, "Sort order:\t%s\n", appConfig.SortOrder)
+	fmt.Fprintf(w, "Block style:\t%s\n", appConfig.BlockStyle)
+	fmt.Fprintf(w, "Colours:\t%s\n", config.ColorLegend(appConfig.ColorNames))
+	fmt.Fprintf(w, "Library:\t%s\n", libraryDescription(appConfig))
+	fmt.Fprintf(w, "Delete policy:\t%s after %d missing syncs, at most %d%% of pages\n", appConfig.DeletePolicy, appConfig.DeleteAfterMissing, appConfig.DeleteMaxPercent)
+	fmt.Fprintf(w, "State file:\t%s\n", appConfig.StatePath)
+	fmt.Fprintf(w, "Last sync:\t%s\n", lastSync)
+	fmt.Fprintf(w, "Synced:\t%d highlights on %d pages\n", len(store.Bookmarks), len(pages))
+
+	// Flat syncs find new highlights in Notion itself and keep no state
+	if appConfig.SyncMode == config.SyncModeGrouped {
+		newestChange := "none"
+		if !store.Watermark.IsZero() {
+			newestChange = store.Watermark.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "Newest synced change:\t%s\n", newestChange)
+		fmt.Fprintf(w, "Pending:\t%d new or edited, %d removed\n", changed, removed)
+	}
+
+	if err := w.Flush(); err != nil {
+		return ExitError
+	}
+	return ExitOK
+}
+
+// runDoctor checks everything a sync needs and prints the result of each check
+func runDoctor(opts *options, args []string) int {
+	flags := opts.newFlagSet("doctor")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if err := opts.initLogger(true); err != nil {
+		return ExitError
+	}
+	defer logger.Close()
+
+	failed := false
+	check := func(name string, result string, err error) {
+		if err != nil {
+			failed = true
+			logger.Logger.Printf("Doctor check %s failed: %v", name, err)
+			fmt.Fprintf(opts.stdout, "[FAIL] %s: %v\n", name, err)
+			return
+		}
+		fmt.Fprintf(opts.stdout, "[ OK ] %s: %s\n", name, result)
+	}
+
+	appConfig, err := opts.loadConfig(true)
+	check("Configuration", opts.configPath, err)
+	if err != nil {
+		return ExitConfig
+	}
+
+	var bookmarks []kobo.Bookmark
+	if _, err = os.Stat(appConfig.DBPath); err == nil {
+		bookmarks, err = getBookmarks(appConfig)
+	}
+	check("Kobo database", fmt.Sprintf("%d highlights in %s", len(bookmarks), appConfig.DBPath), err)
+
+	if appConfig.CertPath != "" {
+		_, err = os.Stat(appConfig.CertPath)
+		check("Certificates", appConfig.CertPath, err)
+	}
+
+	_, err = state.Load(appConfig.StatePath)
+	check("Sync state", appConfig.StatePath, err)
+
+	err = notion.InitializeNotionClient(appConfig.CertPath, appConfig.NotionToken, appConfig.DatabaseID)
+	if err == nil {
+		err = notion.SetProperties(appConfig.Properties)
+	}
+	var title string
+	if err == nil {
+		title, err = notion.CheckNotionDatabase(appConfig.DatabaseID)
+	}
+	check("Notion database", fmt.Sprintf("%q is reachable", title), err)
+
+	if err == nil {
+		var issues []notion.SchemaIssue
+		issues, err = notion.ValidateNotionSchema(appConfig.DatabaseID, appConfig.SyncMode)
+		if err == nil && len(issues) > 0 {
+			err = fmt.Errorf("%s, run 'sync setup' to fix it", joinIssues(issues))
+		}
+		check("Database schema", fmt.Sprintf("all properties of the %s sync mode exist", appConfig.SyncMode), err)
+	}
+
+	if failed {
+		return ExitError
+	}
+	return ExitOK
+}
+
+// runSetup creates a database under a page, or adds the missing properties of the configured database
+func runSetup(opts *options, args []string) int {
+	flags := opts.newFlagSet("setup")
+	parent := flags.String("parent", "", "ID of the page to create a new database under, instead of fixing NOTION_DATABASE_ID")
+	title := flags.String("title", "Kobo Highlights", "Title of the created database")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if err := opts.initLogger(true); err != nil {
+		return ExitError
+	}
+	defer logger.Close()
+
+	appConfig, err := opts.loadConfig(false)
+	if err != nil {
+		return opts.fail(ExitConfig, "Error loading configuration: %v", err)
+	}
+
+	if appConfig.NotionToken == "" || (appConfig.DatabaseID == "" && *parent == "") {
+		return opts.fail(ExitConfig, "Error loading configuration: NOTION_TOKEN and NOTION_DATABASE_ID or --parent are required")
+	}
+
+	err = notion.InitializeNotionClient(appConfig.CertPath, appConfig.NotionToken, appConfig.DatabaseID)
+	if err != nil {
+		return opts.fail(ExitConfig, "Error initializing Notion client: %v", err)
+	}
+
+	if err := notion.SetProperties(appConfig.Properties); err != nil {
+		return opts.fail(ExitError, "Error setting property mapping: %v", err)
+	}
+
+	if *parent != "" {
+		databaseID, err := notion.CreateNotionDatabase(*parent, *title, appConfig.SyncMode)
+		if err != nil {
+			return opts.fail(ExitError, "Error creating Notion database: %v", err)
+		}
+
+		fmt.Fprintf(opts.stdout, "Created database %q for the %s sync mode, set NOTION_DATABASE_ID=%s\n", *title, appConfig.SyncMode, databaseID)
+		return ExitOK
+	}
+
+	remaining, err := notion.FixNotionSchema(appConfig.DatabaseID, appConfig.SyncMode)
+	if err != nil {
+		return opts.fail(ExitError, "Error updating Notion database: %v", err)
+	}
+
+	if len(remaining) > 0 {
+		return opts.fail(ExitConfig, "Added the missing properties, change these by hand: %s", joinIssues(remaining))
+	}
+
+	fmt.Fprintf(opts.stdout, "The database has all properties of the %s sync mode\n", appConfig.SyncMode)
+	return ExitOK
+}
+
+// libraryDescription describes which books without highlights are mirrored
+func libraryDescription(appConfig config.Config) string {
+	if len(appConfig.LibraryStatuses) == 0 {
+		return "books with highlights only"
+	}
+
+	description := strings.Join(appConfig.LibraryStatuses, ", ") + " books"
+	if len(appConfig.LibraryShelves) > 0 {
+		description += " on " + strings.Join(appConfig.LibraryShelves, ", ")
+	}
+	return description
+}
+
+// joinIssues lists schema issues in a single line
+func joinIssues(issues []notion.SchemaIssue) string {
+	descriptions := make([]string, 0, len(issues))
+	for _, issue := range issues {
+		descriptions = append(descriptions, issue.String())
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// runListBooks prints the books with highlights and how many each has
+func runListBooks(opts *options, args []string) int {
+	flags := opts.newFlagSet("list-books")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	if err := opts.initLogger(true); err != nil {
+		return ExitError
+	}
+	defer logger.Close()
+
+	appConfig, err := opts.loadConfig(false)
+	if err != nil {
+		return opts.fail(ExitConfig, "Error loading configuration: %v", err)
+	}
+
+	bookmarks, err := getBookmarks(appConfig)
+	if err != nil {
+		return opts.fail(ExitError, "Error retrieving highlights from database: %v", err)
+	}
+
+	// Books sharing a title are listed apart
+	counts := make(map[string]int)
+	names := make(map[string]string)
+	authors := make(map[string]string)
+	for _, bookmark := range bookmarks {
+		counts[bookmark.VolumeID]++
+		names[bookmark.VolumeID] = utils.GetBookName(bookmark)
+		authors[bookmark.VolumeID] = bookmark.Book.Author
+	}
+
+	volumeIDs := make([]string, 0, len(counts))
+	for volumeID := range counts {
+		volumeIDs = append(volumeIDs, volumeID)
+	}
+	sort.Slice(volumeIDs, func(i, j int) bool {
+		if names[volumeIDs[i]] != names[volumeIDs[j]] {
+			return names[volumeIDs[i]] < names[volumeIDs[j]]
+		}
+		return volumeIDs[i] < volumeIDs[j]
+	})
+
+	w := tabwriter.NewWriter(opts.stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "BOOK\tAUTHOR\tHIGHLIGHTS")
+	for _, volumeID := range volumeIDs {
+		fmt.Fprintf(w, "%s\t%s\t%d\n", names[volumeID], authors[volumeID], counts[volumeID])
+	}
+
+	if err := w.Flush(); err != nil {
+		return ExitError
+	}
+	return ExitOK
+}
+
+// runVersion prints the version of the build
+func runVersion(opts *options, args []string) int {
+	flags := opts.newFlagSet("version")
+	if code, ok := parseFlags(flags, args); !ok {
+		return code
+	}
+
+	fmt.Fprintf(opts.stdout, "kobo-to-notion %s\n", Version)
+	return ExitOK
+}
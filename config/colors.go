@@ -0,0 +1,115 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// HighlightColor is a highlight colour of the Kobo. Every place showing colours, the Notion
+// sync and the Markdown export alike, reads them from HighlightColors so they agree.
+type HighlightColor struct {
+	// Index is the colour as stored with the bookmarks of the Kobo
+	Index string
+	// Name is the colour name, also the name of the matching Notion colour
+	Name string
+	// Emoji is the icon of callouts of the colour
+	Emoji string
+}
+
+// HighlightColors lists the Kobo highlight colours in colour order
+var HighlightColors = []HighlightColor{
+	{Index: "0", Name: "yellow", Emoji: "🟡"},
+	{Index: "1", Name: "pink", Emoji: "🩷"},
+	{Index: "2", Name: "blue", Emoji: "🔵"},
+	{Index: "3", Name: "green", Emoji: "🟢"},
+	{Index: "4", Name: "red", Emoji: "🔴"},
+}
+
+// HighlightColorByIndex returns the colour of a bookmark from its stored index
+func HighlightColorByIndex(index string) (HighlightColor, bool) {
+	for _, color := range HighlightColors {
+		if color.Index == index {
+			return color, true
+		}
+	}
+	return HighlightColor{}, false
+}
+
+// DefaultColorNames returns the category written for each Kobo highlight colour, by colour
+// index. Colours are named after themselves.
+func DefaultColorNames() map[string]string {
+	names := make(map[string]string)
+	for _, color := range HighlightColors {
+		names[color.Index] = strings.ToUpper(color.Name[:1]) + color.Name[1:]
+	}
+	return names
+}
+
+// ParseColorNames applies a comma separated list of colour=Name entries on top of the default
+// colour names. Colours are the Kobo colour names, and mapping a colour to nothing leaves its
+// highlights out of the colour categories.
+func ParseColorNames(value string) (map[string]string, error) {
+	names := DefaultColorNames()
+
+	for _, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		color, name, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid colour name %q, expected colour=Name", entry)
+		}
+
+		index := slices.IndexFunc(HighlightColors, func(c HighlightColor) bool {
+			return c.Name == strings.ToLower(strings.TrimSpace(color))
+		})
+		if index < 0 {
+			return nil, fmt.Errorf("unknown colour %q, expected one of %s", strings.TrimSpace(color), strings.Join(colorList(), ", "))
+		}
+
+		name = strings.TrimSpace(name)
+		if name == "" {
+			delete(names, HighlightColors[index].Index)
+			continue
+		}
+		names[HighlightColors[index].Index] = name
+	}
+
+	return names, nil
+}
+
+// ColorLegend describes the category of each named colour, as colour=Name in colour order
+func ColorLegend(colorNames map[string]string) string {
+	var entries []string
+	for _, color := range HighlightColors {
+		if name, ok := colorNames[color.Index]; ok {
+			entries = append(entries, color.Name+"="+name)
+		}
+	}
+	return strings.Join(entries, ", ")
+}
+
+// ColorCategories returns the names of the colours of the given indexes, in colour order
+// and without duplicates. Colours without a name are left out.
+func ColorCategories(indexes []string, colorNames map[string]string) []string {
+	var names []string
+	for _, color := range HighlightColors {
+		name, named := colorNames[color.Index]
+		if named && slices.Contains(indexes, color.Index) && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// colorList returns the colour names in alphabetical order
+func colorList() []string {
+	var names []string
+	for _, color := range HighlightColors {
+		names = append(names, color.Name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,51 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseColorNames(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		names, err := ParseColorNames("")
+		if err != nil {
+			t.Fatalf("ParseColorNames() error = %v, want nil", err)
+		}
+		if !reflect.DeepEqual(names, DefaultColorNames()) {
+			t.Errorf("ParseColorNames() = %v, want the default colour names", names)
+		}
+	})
+
+	t.Run("Custom names", func(t *testing.T) {
+		names, err := ParseColorNames("yellow=Quote, Blue=Idea, red=")
+		if err != nil {
+			t.Fatalf("ParseColorNames() error = %v, want nil", err)
+		}
+
+		expected := map[string]string{"0": "Quote", "1": "Pink", "2": "Idea", "3": "Green"}
+		if !reflect.DeepEqual(names, expected) {
+			t.Errorf("ParseColorNames() = %v, want %v", names, expected)
+		}
+
+		legend := ColorLegend(names)
+		if legend != "yellow=Quote, pink=Pink, blue=Idea, green=Green" {
+			t.Errorf("ColorLegend() = %q", legend)
+		}
+	})
+
+	t.Run("Categories", func(t *testing.T) {
+		names := map[string]string{"0": "Quote", "1": "Quote", "2": "Idea"}
+		categories := ColorCategories([]string{"2", "1", "0", "2", "3"}, names)
+		if !reflect.DeepEqual(categories, []string{"Quote", "Idea"}) {
+			t.Errorf("ColorCategories() = %v, want named colours in colour order", categories)
+		}
+	})
+
+	t.Run("Invalid names", func(t *testing.T) {
+		for _, value := range []string{"yellow", "purple=Idea"} {
+			if _, err := ParseColorNames(value); err == nil {
+				t.Errorf("ParseColorNames(%q) error = nil, want error", value)
+			}
+		}
+	})
+}
@@ -2,7 +2,13 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"kobo-to-notion/kobo"
+	"math"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -32,34 +38,342 @@ type Config struct {
 	DatabaseID  string
 	DBPath      string
 	CertPath    string
+	StatePath   string
+	SyncMode    string
+	SortOrder   string
+	BlockStyle  string
+	SyncTypes   []string
+	ExportPath  string
+	MarkupsPath string
+	// Properties maps the logical fields written to Notion to database properties
+	Properties map[string]PropertyMapping
+	// ColorNames maps Kobo highlight colour indexes to the categories written to Notion
+	ColorNames map[string]string
+	// LibraryStatuses are the read statuses of the books mirrored without highlights, none when empty
+	LibraryStatuses []string
+	// LibraryShelves limits the mirrored books to those on one of these shelves
+	LibraryShelves []string
+	// DeletePolicy is what happens to pages and highlights removed from the Kobo
+	DeletePolicy string
+	// DeleteAfterMissing is how many syncs in a row a book must be missing before its page is removed
+	DeleteAfterMissing int
+	// DeleteMaxPercent aborts syncs that would remove more than this share of the pages
+	DeleteMaxPercent int
 }
 
+// Sync modes selecting how bookmarks are laid out in the Notion database
+const (
+	// SyncModeGrouped creates a page per book holding all its highlights
+	SyncModeGrouped = "grouped"
+	// SyncModeFlat creates a database row per highlight
+	SyncModeFlat = "flat"
+)
+
+// Orders in which the highlights of a book are written, as sorted by the kobo package
+const (
+	// SortOrderPosition follows the reading position, chapter by chapter
+	SortOrderPosition = kobo.OrderPosition
+	// SortOrderCreatedAsc puts the oldest highlights first
+	SortOrderCreatedAsc = kobo.OrderCreatedAsc
+	// SortOrderCreatedDesc puts the newest highlights first
+	SortOrderCreatedDesc = kobo.OrderCreatedDesc
+)
+
+// Block styles in which highlights are written on book pages
+const (
+	// BlockStyleQuote writes highlights as quotes
+	BlockStyleQuote = "quote"
+	// BlockStyleCallout writes highlights as callouts with an emoji per colour
+	BlockStyleCallout = "callout"
+	// BlockStyleToggle writes highlights as toggles with the note inside
+	BlockStyleToggle = "toggle"
+	// BlockStyleBulleted writes highlights as bulleted list items
+	BlockStyleBulleted = "bulleted"
+)
+
+// Kobo bookmark types that can be synced, as named by the kobo package
+const (
+	TypeHighlight = kobo.TypeHighlight
+	TypeNote      = kobo.TypeNote
+	TypeDogEar    = kobo.TypeDogEar
+	TypeMarkup    = kobo.TypeMarkup
+)
+
+// Read statuses of the books mirrored with SYNC_LIBRARY
+const (
+	ReadStatusUnread   = "unread"
+	ReadStatusReading  = "reading"
+	ReadStatusFinished = "finished"
+	// LibraryAll mirrors books of every read status
+	LibraryAll = "all"
+)
+
+// Policies applied to the pages and highlights of books removed from the Kobo
+const (
+	// DeletePolicyArchive archives pages and deletes highlight blocks
+	DeletePolicyArchive = "archive"
+	// DeletePolicyMark strikes through the title of pages and the highlight blocks
+	DeletePolicyMark = "mark"
+	// DeletePolicyNever keeps pages and highlight blocks untouched
+	DeletePolicyNever = "never"
+)
+
+// DefaultDeleteMaxPercent is the share of pages a sync may remove when DELETE_MAX_PERCENT is not set
+const DefaultDeleteMaxPercent = 50
+
+// DefaultSyncTypes are the bookmark types synced when SYNC_TYPES is not set
+const DefaultSyncTypes = "highlight,note"
+
+// DefaultStatePath is where the sync state is kept when STATE_PATH is not set
+const DefaultStatePath = "./sync_state.json"
+
+// DefaultExportPath is where Markdown files are exported when EXPORT_PATH is not set
+const DefaultExportPath = "./export"
+
+// DefaultEnvPath is the env file read when no other is given
+const DefaultEnvPath = ".env"
+
 // LoadEnv loads environment variables from .env file
 func LoadEnv() error {
 	return godotenv.Load()
 }
 
+// LoadEnvFile loads environment variables from the given env file
+func LoadEnvFile(path string) error {
+	return godotenv.Load(path)
+}
+
 // GetConfig retrieves configuration values from environment variables
 func GetConfig() (Config, error) {
 	return GetConfigWithLoader(&DefaultEnvLoader{})
 }
 
+// GetLocalConfig retrieves the configuration of commands that only read the Kobo database
+func GetLocalConfig() (Config, error) {
+	return GetLocalConfigWithLoader(&DefaultEnvLoader{})
+}
+
 // GetConfigWithLoader retrieves configuration using the provided EnvLoader
 // This allows for dependency injection during testing
 func GetConfigWithLoader(loader EnvLoader) (Config, error) {
+	config, err := GetLocalConfigWithLoader(loader)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if config.NotionToken == "" || config.DatabaseID == "" {
+		return Config{}, errors.New("missing required environment variables")
+	}
+
+	return config, nil
+}
+
+// GetLocalConfigWithLoader retrieves configuration using the provided EnvLoader,
+// without requiring the Notion credentials
+func GetLocalConfigWithLoader(loader EnvLoader) (Config, error) {
 	notionToken := loader.GetEnv("NOTION_TOKEN")
 	databaseID := loader.GetEnv("NOTION_DATABASE_ID")
 	dbPath := loader.GetEnv("KOBO_DB_PATH")
 	certPath := loader.GetEnv("CERT_PATH")
+	statePath := loader.GetEnv("STATE_PATH")
+	syncMode := loader.GetEnv("SYNC_MODE")
+	sortOrder := loader.GetEnv("SORT_ORDER")
+	blockStyle := loader.GetEnv("BLOCK_STYLE")
+	exportPath := loader.GetEnv("EXPORT_PATH")
+	propertyMapping := loader.GetEnv("NOTION_PROPERTIES")
+	highlightColors := loader.GetEnv("HIGHLIGHT_COLORS")
+	syncTypes := loader.GetEnv("SYNC_TYPES")
+	markupsPath := loader.GetEnv("MARKUPS_PATH")
+	syncLibrary := loader.GetEnv("SYNC_LIBRARY")
+	libraryShelves := loader.GetEnv("SYNC_LIBRARY_SHELVES")
+	deletePolicy := loader.GetEnv("DELETE_POLICY")
+	deleteAfterMissing := loader.GetEnv("DELETE_AFTER_MISSING")
+	deleteMaxPercent := loader.GetEnv("DELETE_MAX_PERCENT")
 
-	if notionToken == "" || databaseID == "" || dbPath == "" {
+	if dbPath == "" {
 		return Config{}, errors.New("missing required environment variables")
 	}
 
+	if statePath == "" {
+		statePath = DefaultStatePath
+	}
+
+	if exportPath == "" {
+		exportPath = DefaultExportPath
+	}
+
+	switch syncMode {
+	case "":
+		syncMode = SyncModeGrouped
+	case SyncModeGrouped, SyncModeFlat:
+	default:
+		return Config{}, fmt.Errorf("invalid SYNC_MODE %q, expected %q or %q", syncMode, SyncModeGrouped, SyncModeFlat)
+	}
+
+	switch sortOrder {
+	case "":
+		sortOrder = SortOrderPosition
+	case SortOrderPosition, SortOrderCreatedAsc, SortOrderCreatedDesc:
+	default:
+		return Config{}, fmt.Errorf("invalid SORT_ORDER %q, expected %q, %q or %q", sortOrder, SortOrderPosition, SortOrderCreatedAsc, SortOrderCreatedDesc)
+	}
+
+	switch blockStyle {
+	case "":
+		blockStyle = BlockStyleQuote
+	case BlockStyleQuote, BlockStyleCallout, BlockStyleToggle, BlockStyleBulleted:
+	default:
+		return Config{}, fmt.Errorf("invalid BLOCK_STYLE %q, expected %q, %q, %q or %q", blockStyle, BlockStyleQuote, BlockStyleCallout, BlockStyleToggle, BlockStyleBulleted)
+	}
+
+	properties, err := ParseProperties(propertyMapping)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid NOTION_PROPERTIES: %w", err)
+	}
+
+	if syncTypes == "" {
+		syncTypes = DefaultSyncTypes
+	}
+
+	types, err := ParseSyncTypes(syncTypes)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid SYNC_TYPES: %w", err)
+	}
+
+	colorNames, err := ParseColorNames(highlightColors)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid HIGHLIGHT_COLORS: %w", err)
+	}
+
+	libraryStatuses, err := ParseLibraryStatuses(syncLibrary)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid SYNC_LIBRARY: %w", err)
+	}
+
+	shelves := splitList(libraryShelves)
+	if len(shelves) > 0 && len(libraryStatuses) == 0 {
+		return Config{}, errors.New("SYNC_LIBRARY_SHELVES requires SYNC_LIBRARY")
+	}
+
+	// Books without highlights have no rows in flat mode
+	if len(libraryStatuses) > 0 && syncMode == SyncModeFlat {
+		return Config{}, fmt.Errorf("SYNC_LIBRARY is only supported in %s sync mode", SyncModeGrouped)
+	}
+
+	switch deletePolicy {
+	case "":
+		deletePolicy = DeletePolicyArchive
+	case DeletePolicyArchive, DeletePolicyMark, DeletePolicyNever:
+	default:
+		return Config{}, fmt.Errorf("invalid DELETE_POLICY %q, expected %q, %q or %q", deletePolicy, DeletePolicyArchive, DeletePolicyMark, DeletePolicyNever)
+	}
+
+	afterMissing, err := parseNumber(deleteAfterMissing, 1, 1, math.MaxInt32)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid DELETE_AFTER_MISSING: %w", err)
+	}
+
+	maxPercent, err := parseNumber(deleteMaxPercent, DefaultDeleteMaxPercent, 0, 100)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid DELETE_MAX_PERCENT: %w", err)
+	}
+
+	// Flat syncs find the highlights already in Notion by their bookmark ID
+	if _, ok := properties[FieldBookmarkID]; !ok && syncMode == SyncModeFlat {
+		return Config{}, fmt.Errorf("invalid NOTION_PROPERTIES: the %q field is required in %s sync mode", FieldBookmarkID, SyncModeFlat)
+	}
+
 	return Config{
 		NotionToken: notionToken,
 		DatabaseID:  databaseID,
 		DBPath:      dbPath,
 		CertPath:    certPath,
+		StatePath:   statePath,
+		SyncMode:    syncMode,
+		SortOrder:   sortOrder,
+		BlockStyle:  blockStyle,
+		ExportPath:  exportPath,
+		MarkupsPath: markupsPath,
+		Properties:  properties,
+		ColorNames:  colorNames,
+		SyncTypes:   types,
+
+		LibraryStatuses: libraryStatuses,
+		LibraryShelves:  shelves,
+
+		DeletePolicy:       deletePolicy,
+		DeleteAfterMissing: afterMissing,
+		DeleteMaxPercent:   maxPercent,
 	}, nil
 }
+
+// ParseSyncTypes parses a comma separated list of Kobo bookmark types
+func ParseSyncTypes(value string) ([]string, error) {
+	known := []string{TypeHighlight, TypeNote, TypeDogEar, TypeMarkup}
+
+	var types []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !slices.Contains(known, name) {
+			return nil, fmt.Errorf("unknown bookmark type %q, expected one of %s", name, strings.Join(known, ", "))
+		}
+		if !slices.Contains(types, name) {
+			types = append(types, name)
+		}
+	}
+
+	if len(types) == 0 {
+		return nil, errors.New("no bookmark type selected")
+	}
+	return types, nil
+}
+
+// ParseLibraryStatuses parses a comma separated list of read statuses, or all of them
+func ParseLibraryStatuses(value string) ([]string, error) {
+	known := []string{ReadStatusUnread, ReadStatusReading, ReadStatusFinished}
+
+	var statuses []string
+	for _, name := range splitList(strings.ToLower(value)) {
+		if name == LibraryAll {
+			return known, nil
+		}
+		if !slices.Contains(known, name) {
+			return nil, fmt.Errorf("unknown read status %q, expected %s or one of %s", name, LibraryAll, strings.Join(known, ", "))
+		}
+		if !slices.Contains(statuses, name) {
+			statuses = append(statuses, name)
+		}
+	}
+	return statuses, nil
+}
+
+// splitList splits a comma separated list, leaving out blank entries
+func splitList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// parseNumber parses a whole number between lowest and highest, empty values yield the default
+func parseNumber(value string, defaultValue int, lowest int, highest int) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a whole number", value)
+	}
+	if number < lowest || number > highest {
+		return 0, fmt.Errorf("%d is not between %d and %d", number, lowest, highest)
+	}
+	return number, nil
+}
@@ -2,7 +2,10 @@ package config
 
 import (
 	"os"
+	"reflect"
 	"testing"
+
+	"github.com/joho/godotenv"
 )
 
 // MockEnvLoader implements EnvLoader for testing
@@ -75,6 +78,23 @@ CERT_PATH=/path/to/cert
 	}
 }
 
+func TestEnvExample(t *testing.T) {
+	// The README has users copy env.example as their .env
+	values, err := godotenv.Read("../env.example")
+	if err != nil {
+		t.Fatalf("Failed to read env.example: %v", err)
+	}
+
+	loader := NewMockEnvLoader()
+	for key, value := range values {
+		loader.SetEnv(key, value)
+	}
+
+	if _, err := GetLocalConfigWithLoader(loader); err != nil {
+		t.Errorf("GetLocalConfigWithLoader() with env.example error = %v, want nil", err)
+	}
+}
+
 func TestGetConfigWithLoader(t *testing.T) {
 	// Test with all required values
 	t.Run("All values present", func(t *testing.T) {
@@ -102,6 +122,48 @@ func TestGetConfigWithLoader(t *testing.T) {
 		if config.CertPath != "/path/to/cert" {
 			t.Errorf("config.CertPath = %v, want %v", config.CertPath, "/path/to/cert")
 		}
+		if config.StatePath != DefaultStatePath {
+			t.Errorf("config.StatePath = %v, want %v", config.StatePath, DefaultStatePath)
+		}
+		if config.ExportPath != DefaultExportPath {
+			t.Errorf("config.ExportPath = %v, want %v", config.ExportPath, DefaultExportPath)
+		}
+	})
+
+	// Test with a custom state path
+	t.Run("Custom state path", func(t *testing.T) {
+		mock := NewMockEnvLoader()
+		mock.SetEnv("NOTION_TOKEN", "test_token")
+		mock.SetEnv("NOTION_DATABASE_ID", "test_database_id")
+		mock.SetEnv("KOBO_DB_PATH", "/path/to/kobo.db")
+		mock.SetEnv("STATE_PATH", "/path/to/state.json")
+
+		config, err := GetConfigWithLoader(mock)
+
+		if err != nil {
+			t.Errorf("GetConfigWithLoader() error = %v, want nil", err)
+		}
+		if config.StatePath != "/path/to/state.json" {
+			t.Errorf("config.StatePath = %v, want %v", config.StatePath, "/path/to/state.json")
+		}
+	})
+
+	// Test with a custom export path
+	t.Run("Custom export path", func(t *testing.T) {
+		mock := NewMockEnvLoader()
+		mock.SetEnv("NOTION_TOKEN", "test_token")
+		mock.SetEnv("NOTION_DATABASE_ID", "test_database_id")
+		mock.SetEnv("KOBO_DB_PATH", "/path/to/kobo.db")
+		mock.SetEnv("EXPORT_PATH", "/path/to/vault")
+
+		config, err := GetConfigWithLoader(mock)
+
+		if err != nil {
+			t.Errorf("GetConfigWithLoader() error = %v, want nil", err)
+		}
+		if config.ExportPath != "/path/to/vault" {
+			t.Errorf("config.ExportPath = %v, want %v", config.ExportPath, "/path/to/vault")
+		}
 	})
 
 	// Test with missing values
@@ -210,3 +272,267 @@ func TestGetConfig(t *testing.T) {
 		t.Errorf("config.CertPath = %v, want %v", config.CertPath, "/path/to/cert")
 	}
 }
+
+func TestGetConfigSyncMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		syncMode string
+		expected string
+		wantErr  bool
+	}{
+		{"Default mode", "", SyncModeGrouped, false},
+		{"Grouped mode", "grouped", SyncModeGrouped, false},
+		{"Flat mode", "flat", SyncModeFlat, false},
+		{"Unknown mode", "tree", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockEnvLoader()
+			mock.SetEnv("NOTION_TOKEN", "test_token")
+			mock.SetEnv("NOTION_DATABASE_ID", "test_database_id")
+			mock.SetEnv("KOBO_DB_PATH", "/path/to/kobo.db")
+			mock.SetEnv("SYNC_MODE", tt.syncMode)
+
+			config, err := GetConfigWithLoader(mock)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetConfigWithLoader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if config.SyncMode != tt.expected {
+				t.Errorf("config.SyncMode = %v, want %v", config.SyncMode, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetConfigSortOrder(t *testing.T) {
+	tests := []struct {
+		name      string
+		sortOrder string
+		expected  string
+		wantErr   bool
+	}{
+		{"Default order", "", SortOrderPosition, false},
+		{"Position order", "position", SortOrderPosition, false},
+		{"Oldest first", "created_asc", SortOrderCreatedAsc, false},
+		{"Newest first", "created_desc", SortOrderCreatedDesc, false},
+		{"Unknown order", "color", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockEnvLoader()
+			mock.SetEnv("KOBO_DB_PATH", "/path/to/kobo.db")
+			mock.SetEnv("SORT_ORDER", tt.sortOrder)
+
+			config, err := GetLocalConfigWithLoader(mock)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetLocalConfigWithLoader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if config.SortOrder != tt.expected {
+				t.Errorf("config.SortOrder = %v, want %v", config.SortOrder, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetConfigBlockStyle(t *testing.T) {
+	tests := []struct {
+		name       string
+		blockStyle string
+		expected   string
+		wantErr    bool
+	}{
+		{"Default style", "", BlockStyleQuote, false},
+		{"Quotes", "quote", BlockStyleQuote, false},
+		{"Callouts", "callout", BlockStyleCallout, false},
+		{"Toggles", "toggle", BlockStyleToggle, false},
+		{"Bulleted list", "bulleted", BlockStyleBulleted, false},
+		{"Unknown style", "table", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockEnvLoader()
+			mock.SetEnv("KOBO_DB_PATH", "/path/to/kobo.db")
+			mock.SetEnv("BLOCK_STYLE", tt.blockStyle)
+
+			config, err := GetLocalConfigWithLoader(mock)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetLocalConfigWithLoader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if config.BlockStyle != tt.expected {
+				t.Errorf("config.BlockStyle = %v, want %v", config.BlockStyle, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetConfigSyncTypes(t *testing.T) {
+	tests := []struct {
+		name      string
+		syncTypes string
+		expected  []string
+		wantErr   bool
+	}{
+		{"Default types", "", []string{TypeHighlight, TypeNote}, false},
+		{"Highlights only", "highlight", []string{TypeHighlight}, false},
+		{"Spaces and duplicates", " note, Markup ,note", []string{TypeNote, TypeMarkup}, false},
+		{"Unknown type", "highlight,bookmark", nil, true},
+		{"No type", ",", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockEnvLoader()
+			mock.SetEnv("KOBO_DB_PATH", "/path/to/kobo.db")
+			mock.SetEnv("SYNC_TYPES", tt.syncTypes)
+
+			config, err := GetLocalConfigWithLoader(mock)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetLocalConfigWithLoader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(config.SyncTypes, tt.expected) {
+				t.Errorf("config.SyncTypes = %v, want %v", config.SyncTypes, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetConfigSyncLibrary(t *testing.T) {
+	tests := []struct {
+		name             string
+		syncLibrary      string
+		shelves          string
+		syncMode         string
+		expectedStatuses []string
+		expectedShelves  []string
+		wantErr          bool
+	}{
+		{"Not mirrored by default", "", "", "", nil, nil, false},
+		{"Every status", "all", "", "", []string{ReadStatusUnread, ReadStatusReading, ReadStatusFinished}, nil, false},
+		{"Statuses and shelves", " Reading,finished,reading", "Work, Book Club", "", []string{ReadStatusReading, ReadStatusFinished}, []string{"Work", "Book Club"}, false},
+		{"Unknown status", "abandoned", "", "", nil, nil, true},
+		{"Shelves without library", "", "Work", "", nil, nil, true},
+		{"Flat mode", "all", "", SyncModeFlat, nil, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockEnvLoader()
+			mock.SetEnv("KOBO_DB_PATH", "/path/to/kobo.db")
+			mock.SetEnv("SYNC_LIBRARY", tt.syncLibrary)
+			mock.SetEnv("SYNC_LIBRARY_SHELVES", tt.shelves)
+			mock.SetEnv("SYNC_MODE", tt.syncMode)
+
+			config, err := GetLocalConfigWithLoader(mock)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetLocalConfigWithLoader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(config.LibraryStatuses, tt.expectedStatuses) {
+				t.Errorf("config.LibraryStatuses = %v, want %v", config.LibraryStatuses, tt.expectedStatuses)
+			}
+			if !reflect.DeepEqual(config.LibraryShelves, tt.expectedShelves) {
+				t.Errorf("config.LibraryShelves = %v, want %v", config.LibraryShelves, tt.expectedShelves)
+			}
+		})
+	}
+}
+
+func TestGetConfigDeletePolicy(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       string
+		afterMissing string
+		maxPercent   string
+		expected     []any
+		wantErr      bool
+	}{
+		{"Defaults", "", "", "", []any{DeletePolicyArchive, 1, DefaultDeleteMaxPercent}, false},
+		{"Mark after three syncs", "mark", "3", "100", []any{DeletePolicyMark, 3, 100}, false},
+		{"Never remove", "never", "", " 0", []any{DeletePolicyNever, 1, 0}, false},
+		{"Unknown policy", "delete", "", "", nil, true},
+		{"No missing sync", "", "0", "", nil, true},
+		{"Not a number", "", "two", "", nil, true},
+		{"Over a hundred percent", "", "", "150", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := NewMockEnvLoader()
+			mock.SetEnv("KOBO_DB_PATH", "/path/to/kobo.db")
+			mock.SetEnv("DELETE_POLICY", tt.policy)
+			mock.SetEnv("DELETE_AFTER_MISSING", tt.afterMissing)
+			mock.SetEnv("DELETE_MAX_PERCENT", tt.maxPercent)
+
+			config, err := GetLocalConfigWithLoader(mock)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetLocalConfigWithLoader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := []any{config.DeletePolicy, config.DeleteAfterMissing, config.DeleteMaxPercent}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("delete policy = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetLocalConfigWithLoader(t *testing.T) {
+	t.Run("Notion credentials are optional", func(t *testing.T) {
+		mock := NewMockEnvLoader()
+		mock.SetEnv("KOBO_DB_PATH", "/path/to/kobo.db")
+
+		config, err := GetLocalConfigWithLoader(mock)
+
+		if err != nil {
+			t.Errorf("GetLocalConfigWithLoader() error = %v, want nil", err)
+		}
+		if config.DBPath != "/path/to/kobo.db" {
+			t.Errorf("config.DBPath = %v, want %v", config.DBPath, "/path/to/kobo.db")
+		}
+	})
+
+	t.Run("Missing KOBO_DB_PATH", func(t *testing.T) {
+		mock := NewMockEnvLoader()
+		mock.SetEnv("NOTION_TOKEN", "test_token")
+		mock.SetEnv("NOTION_DATABASE_ID", "test_database_id")
+
+		_, err := GetLocalConfigWithLoader(mock)
+
+		if err == nil {
+			t.Error("GetLocalConfigWithLoader() error = nil, want error for missing KOBO_DB_PATH")
+		}
+	})
+}
+
+func TestGetConfigProperties(t *testing.T) {
+	mock := NewMockEnvLoader()
+	mock.SetEnv("NOTION_TOKEN", "test_token")
+	mock.SetEnv("NOTION_DATABASE_ID", "test_database_id")
+	mock.SetEnv("KOBO_DB_PATH", "/path/to/kobo.db")
+	mock.SetEnv("NOTION_PROPERTIES", "title=Name")
+
+	config, err := GetConfigWithLoader(mock)
+	if err != nil {
+		t.Fatalf("GetConfigWithLoader() error = %v, want nil", err)
+	}
+	if config.Properties[FieldTitle].Name != "Name" {
+		t.Errorf("config.Properties[title] = %v, want Name", config.Properties[FieldTitle])
+	}
+
+	// Flat syncs cannot find existing highlights without their bookmark ID
+	mock.SetEnv("SYNC_MODE", SyncModeFlat)
+	mock.SetEnv("NOTION_PROPERTIES", "bookmark_id=")
+	if _, err := GetConfigWithLoader(mock); err == nil {
+		t.Error("GetConfigWithLoader() error = nil, want error for unmapped bookmark_id in flat mode")
+	}
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Logical fields a sync can write to the Notion database
+const (
+	FieldTitle          = "title"
+	FieldBookName       = "book_name"
+	FieldAuthor         = "author"
+	FieldISBN           = "isbn"
+	FieldPublisher      = "publisher"
+	FieldSeries         = "series"
+	FieldLanguage       = "language"
+	FieldCreated        = "created"
+	FieldLastHighlight  = "last_highlight"
+	FieldHighlightCount = "highlight_count"
+	FieldColors         = "colors"
+	FieldShelves        = "shelves"
+	FieldProgress       = "progress"
+	FieldReadStatus     = "read_status"
+	FieldTimeSpent      = "time_spent"
+	FieldFirstOpened    = "first_opened"
+	FieldLastRead       = "last_read"
+	FieldFinished       = "finished"
+	FieldRemoved        = "removed"
+	FieldHighlight      = "highlight"
+	FieldAnnotation     = "annotation"
+	FieldType           = "type"
+	FieldBookmarkID     = "bookmark_id"
+)
+
+// Notion property types a field can be written as
+const (
+	PropertyTypeTitle       = "title"
+	PropertyTypeRichText    = "rich_text"
+	PropertyTypeSelect      = "select"
+	PropertyTypeMultiSelect = "multi_select"
+	PropertyTypeDate        = "date"
+	PropertyTypeNumber      = "number"
+)
+
+// PropertyMapping is the Notion property a logical field is written to
+type PropertyMapping struct {
+	Name string
+	Type string
+	// Optional properties are only written when the database has them, so databases
+	// made before they were added keep syncing
+	Optional bool
+}
+
+// fieldTypes lists the property types each field can be written as, the first being its default
+var fieldTypes = map[string][]string{
+	FieldTitle:          {PropertyTypeTitle},
+	FieldBookName:       {PropertyTypeRichText, PropertyTypeSelect},
+	FieldAuthor:         {PropertyTypeRichText, PropertyTypeSelect, PropertyTypeMultiSelect},
+	FieldISBN:           {PropertyTypeRichText},
+	FieldPublisher:      {PropertyTypeRichText, PropertyTypeSelect},
+	FieldSeries:         {PropertyTypeRichText, PropertyTypeSelect},
+	FieldLanguage:       {PropertyTypeRichText, PropertyTypeSelect},
+	FieldCreated:        {PropertyTypeDate, PropertyTypeRichText},
+	FieldLastHighlight:  {PropertyTypeDate, PropertyTypeRichText},
+	FieldHighlightCount: {PropertyTypeNumber, PropertyTypeRichText},
+	FieldColors:         {PropertyTypeMultiSelect, PropertyTypeSelect, PropertyTypeRichText},
+	FieldShelves:        {PropertyTypeMultiSelect, PropertyTypeRichText},
+	FieldProgress:       {PropertyTypeNumber, PropertyTypeRichText},
+	FieldReadStatus:     {PropertyTypeSelect, PropertyTypeRichText},
+	FieldTimeSpent:      {PropertyTypeNumber, PropertyTypeRichText},
+	FieldFirstOpened:    {PropertyTypeDate, PropertyTypeRichText},
+	FieldLastRead:       {PropertyTypeDate, PropertyTypeRichText},
+	FieldFinished:       {PropertyTypeDate, PropertyTypeRichText},
+	FieldRemoved:        {PropertyTypeDate, PropertyTypeRichText},
+	FieldHighlight:      {PropertyTypeRichText},
+	FieldAnnotation:     {PropertyTypeRichText},
+	FieldType:           {PropertyTypeRichText, PropertyTypeSelect},
+	FieldBookmarkID:     {PropertyTypeRichText},
+}
+
+// DefaultProperties returns the property names documented in the README. Series, language,
+// last highlight, highlight count, colours, shelves, reading progress and removal date are only written
+// once mapped in NOTION_PROPERTIES. Author, ISBN and publisher are optional until mapped.
+func DefaultProperties() map[string]PropertyMapping {
+	return map[string]PropertyMapping{
+		FieldTitle:      {Name: "Book Title", Type: PropertyTypeTitle},
+		FieldBookName:   {Name: "Book Name", Type: PropertyTypeRichText},
+		FieldAuthor:     {Name: "Author", Type: PropertyTypeRichText, Optional: true},
+		FieldISBN:       {Name: "ISBN", Type: PropertyTypeRichText, Optional: true},
+		FieldPublisher:  {Name: "Publisher", Type: PropertyTypeRichText, Optional: true},
+		FieldCreated:    {Name: "Date Created", Type: PropertyTypeDate},
+		FieldHighlight:  {Name: "Highlighted Text", Type: PropertyTypeRichText},
+		FieldAnnotation: {Name: "Annotation", Type: PropertyTypeRichText},
+		FieldType:       {Name: "Type", Type: PropertyTypeRichText},
+		FieldBookmarkID: {Name: "Bookmark ID", Type: PropertyTypeRichText},
+	}
+}
+
+// ParseProperties applies a comma separated list of field=Property Name[:type] mappings
+// on top of the default properties. Mapping a field to nothing stops writing it.
+func ParseProperties(value string) (map[string]PropertyMapping, error) {
+	properties := DefaultProperties()
+
+	for _, entry := range strings.Split(value, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		field, name, found := strings.Cut(entry, "=")
+		field = strings.TrimSpace(field)
+		if !found {
+			return nil, fmt.Errorf("invalid property mapping %q, expected field=Property Name", entry)
+		}
+
+		types, known := fieldTypes[field]
+		if !known {
+			return nil, fmt.Errorf("unknown field %q in property mapping", field)
+		}
+
+		name = strings.TrimSpace(name)
+		if name == "" {
+			delete(properties, field)
+			continue
+		}
+
+		// Property names may contain colons, only a known type after the last one is a type
+		propertyType := types[0]
+		if i := strings.LastIndex(name, ":"); i >= 0 && slices.Contains(propertyTypes(), strings.TrimSpace(name[i+1:])) {
+			propertyType = strings.TrimSpace(name[i+1:])
+			name = strings.TrimSpace(name[:i])
+		}
+
+		if !slices.Contains(types, propertyType) {
+			return nil, fmt.Errorf("field %q cannot be written as %s, expected one of %s", field, propertyType, strings.Join(types, ", "))
+		}
+
+		properties[field] = PropertyMapping{Name: name, Type: propertyType}
+	}
+
+	if _, ok := properties[FieldTitle]; !ok {
+		return nil, fmt.Errorf("the %q field cannot be unmapped, every page needs a title", FieldTitle)
+	}
+
+	// Two fields written to the same property would overwrite each other
+	names := make(map[string]string)
+	for field, mapping := range properties {
+		if other, exists := names[mapping.Name]; exists {
+			return nil, fmt.Errorf("fields %q and %q are both mapped to property %q", min(field, other), max(field, other), mapping.Name)
+		}
+		names[mapping.Name] = field
+	}
+
+	return properties, nil
+}
+
+// propertyTypes returns every supported property type
+func propertyTypes() []string {
+	return []string{PropertyTypeTitle, PropertyTypeRichText, PropertyTypeSelect, PropertyTypeMultiSelect, PropertyTypeDate, PropertyTypeNumber}
+}
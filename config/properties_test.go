@@ -0,0 +1,64 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProperties(t *testing.T) {
+	t.Run("Defaults", func(t *testing.T) {
+		properties, err := ParseProperties("")
+		if err != nil {
+			t.Fatalf("ParseProperties() error = %v, want nil", err)
+		}
+		if !reflect.DeepEqual(properties, DefaultProperties()) {
+			t.Errorf("ParseProperties() = %v, want the default properties", properties)
+		}
+	})
+
+	t.Run("Custom names and types", func(t *testing.T) {
+		properties, err := ParseProperties("title=Name, author=Writer:select, created=Started, highlight_count=Highlights, last_highlight=Last: Highlight, isbn=")
+		if err != nil {
+			t.Fatalf("ParseProperties() error = %v, want nil", err)
+		}
+
+		expected := map[string]PropertyMapping{
+			FieldTitle:          {Name: "Name", Type: PropertyTypeTitle},
+			FieldAuthor:         {Name: "Writer", Type: PropertyTypeSelect},
+			FieldCreated:        {Name: "Started", Type: PropertyTypeDate},
+			FieldHighlightCount: {Name: "Highlights", Type: PropertyTypeNumber},
+			FieldLastHighlight:  {Name: "Last: Highlight", Type: PropertyTypeDate},
+		}
+		for field, mapping := range expected {
+			if properties[field] != mapping {
+				t.Errorf("properties[%q] = %v, want %v", field, properties[field], mapping)
+			}
+		}
+
+		if _, ok := properties[FieldISBN]; ok {
+			t.Error("Expected isbn to be unmapped")
+		}
+		if properties[FieldBookName].Name != "Book Name" {
+			t.Errorf("Expected unlisted fields to keep their default, got %v", properties[FieldBookName])
+		}
+
+		// Defaults added after the first release are only written when the database has them
+		if !properties[FieldPublisher].Optional {
+			t.Errorf("Expected the default publisher property to be optional, got %v", properties[FieldPublisher])
+		}
+	})
+
+	t.Run("Invalid mappings", func(t *testing.T) {
+		for _, value := range []string{
+			"title",
+			"unknown=Name",
+			"title=",
+			"created=Started:select",
+			"author=Name,book_name=Name",
+		} {
+			if _, err := ParseProperties(value); err == nil {
+				t.Errorf("ParseProperties(%q) error = nil, want error", value)
+			}
+		}
+	})
+}
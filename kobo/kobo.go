@@ -6,14 +6,40 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// Book holds the metadata Kobo stores for a volume in the content table
+type Book struct {
+	VolumeID  string
+	Title     string
+	Author    string
+	Publisher string
+	ISBN      string
+	Language  string
+	Series    string
+	// Reading is the reading progress of the book, nil when unknown
+	Reading *ReadingStats
+	// Shelves are the collections the book is on
+	Shelves []string
+}
+
 type Bookmark struct {
-	BookmarkID  string
-	VolumeID    string
-	Text        string
-	Annotation  string
-	Type        string
-	DateCreated string
-	Color       string
+	BookmarkID   string
+	VolumeID     string
+	Text         string
+	Annotation   string
+	Type         string
+	DateCreated  string
+	DateModified string
+	Color        string
+	// ContentID is the chapter file the bookmark was made in
+	ContentID    string
+	ChapterTitle string
+	// ChapterIndex is the reading order of the chapter in the book, -1 when unknown
+	ChapterIndex       int
+	StartContainerPath string
+	StartOffset        int
+	// ChapterProgress is how far into its chapter the bookmark is, from 0 to 1
+	ChapterProgress float64
+	Book            Book
 }
 
 // DatabaseAccessor defines an interface for database operations
@@ -45,18 +71,44 @@ func (sa *SQLiteAccessor) GetBookmarks() ([]Bookmark, error) {
 }
 
 func queryBookmarks(db *sql.DB) ([]Bookmark, error) {
+	// The book itself is the content row whose ContentID equals the bookmark VolumeID.
+	// Sideloaded files may have no such row, so every column falls back to ''.
+	// The chapter is the content row of the bookmark ContentID, its title often only
+	// exists on the table of contents entries whose ContentID starts with it.
+	// Dog-ears and markups have no text but mark a place in the book.
 	query := `
     SELECT
-      BookmarkID,
-      VolumeID,
-      IFNULL(Text, '') AS Text,
-      IFNULL(Annotation, '') AS Annotation,
-      Type,
-      DateCreated,
-      Color
-    FROM Bookmark
-    WHERE Annotation IS NOT NULL OR Text IS NOT NULL
-    ORDER BY DateCreated DESC;
+      b.BookmarkID,
+      b.VolumeID,
+      IFNULL(b.Text, '') AS Text,
+      IFNULL(b.Annotation, '') AS Annotation,
+      b.Type,
+      b.DateCreated,
+      IFNULL(b.DateModified, b.DateCreated) AS DateModified,
+      IFNULL(b.Color, '') AS Color,
+      IFNULL(b.ContentID, '') AS ContentID,
+      IFNULL(NULLIF(ch.Title, ''), IFNULL((
+        SELECT toc.Title FROM content toc
+        WHERE toc.ContentID > b.ContentID AND toc.ContentID < b.ContentID || char(1114111)
+          AND IFNULL(toc.Title, '') != ''
+        ORDER BY toc.ContentID
+        LIMIT 1
+      ), '')) AS ChapterTitle,
+      IFNULL(ch.VolumeIndex, -1) AS ChapterIndex,
+      IFNULL(b.StartContainerPath, '') AS StartContainerPath,
+      IFNULL(b.StartOffset, 0) AS StartOffset,
+      IFNULL(b.ChapterProgress, 0) AS ChapterProgress,
+      IFNULL(c.Title, '') AS Title,
+      IFNULL(c.Attribution, '') AS Attribution,
+      IFNULL(c.Publisher, '') AS Publisher,
+      IFNULL(c.ISBN, '') AS ISBN,
+      IFNULL(c.Language, '') AS Language,
+      IFNULL(c.Series, '') AS Series
+    FROM Bookmark b
+    LEFT JOIN content c ON c.ContentID = b.VolumeID
+    LEFT JOIN content ch ON ch.ContentID = b.ContentID
+    WHERE b.Annotation IS NOT NULL OR b.Text IS NOT NULL OR b.Type IN ('dogear', 'markup')
+    ORDER BY b.DateCreated DESC;
     `
 
 	rows, err := db.Query(query)
@@ -68,9 +120,14 @@ func queryBookmarks(db *sql.DB) ([]Bookmark, error) {
 	var bookmarks []Bookmark
 	for rows.Next() {
 		var bm Bookmark
-		if err := rows.Scan(&bm.BookmarkID, &bm.VolumeID, &bm.Text, &bm.Annotation, &bm.Type, &bm.DateCreated, &bm.Color); err != nil {
+		if err := rows.Scan(
+			&bm.BookmarkID, &bm.VolumeID, &bm.Text, &bm.Annotation, &bm.Type, &bm.DateCreated, &bm.DateModified, &bm.Color,
+			&bm.ContentID, &bm.ChapterTitle, &bm.ChapterIndex, &bm.StartContainerPath, &bm.StartOffset, &bm.ChapterProgress,
+			&bm.Book.Title, &bm.Book.Author, &bm.Book.Publisher, &bm.Book.ISBN, &bm.Book.Language, &bm.Book.Series,
+		); err != nil {
 			return nil, err
 		}
+		bm.Book.VolumeID = bm.VolumeID
 		bookmarks = append(bookmarks, bm)
 	}
 
@@ -34,13 +34,28 @@ func createTestDatabase(t *testing.T) (string, func()) {
 			Annotation TEXT,
 			Type TEXT,
 			DateCreated TEXT,
-			Color TEXT
+			DateModified TEXT,
+			Color TEXT,
+			ContentID TEXT,
+			StartContainerPath TEXT,
+			StartOffset INTEGER,
+			ChapterProgress REAL
+		);
+		CREATE TABLE content (
+			ContentID TEXT PRIMARY KEY,
+			Title TEXT,
+			Attribution TEXT,
+			Publisher TEXT,
+			ISBN TEXT,
+			Language TEXT,
+			Series TEXT,
+			VolumeIndex INTEGER
 		);
 	`)
 	if err != nil {
 		db.Close()
 		os.RemoveAll(tempDir)
-		t.Fatalf("Failed to create Bookmark table: %v", err)
+		t.Fatalf("Failed to create test tables: %v", err)
 	}
 
 	// Insert test data
@@ -51,6 +66,15 @@ func createTestDatabase(t *testing.T) (string, func()) {
 		('bm3', 'vol2', NULL, 'Sample annotation 3', 'note', '2023-01-02T12:00:00Z', '2'),
 		('bm4', 'vol2', 'Sample text 4', 'Sample annotation 4', 'highlight', '2023-01-01T12:00:00Z', '3'),
 		('bm5', 'vol3', NULL, NULL, 'bookmark', '2023-01-05T12:00:00Z', '4');
+		UPDATE Bookmark SET DateModified = '2023-02-01T12:00:00Z' WHERE BookmarkID = 'bm1';
+		INSERT INTO content (ContentID, Title, Attribution, Publisher, ISBN, Language, Series) VALUES
+		('vol1', 'Sample Book', 'Jane Doe', 'Sample Press', '9780000000001', 'en', 'Samples');
+		INSERT INTO content (ContentID, Title, VolumeIndex) VALUES
+		('vol1!OEBPS!ch1.xhtml', NULL, 1),
+		('vol1!OEBPS!ch1.xhtml-1', 'Chapter One', NULL),
+		('vol1!OEBPS!ch2.xhtml', 'Chapter Two', 2);
+		UPDATE Bookmark SET ContentID = 'vol1!OEBPS!ch2.xhtml', StartContainerPath = 'span#kobo\.2\.1' WHERE BookmarkID = 'bm1';
+		UPDATE Bookmark SET ContentID = 'vol1!OEBPS!ch1.xhtml', StartContainerPath = 'span#kobo\.10\.1' WHERE BookmarkID = 'bm2';
 	`)
 	if err != nil {
 		db.Close()
@@ -110,6 +134,60 @@ func TestGetBookmarks(t *testing.T) {
 	}
 }
 
+func TestGetBookmarksBookMetadata(t *testing.T) {
+	dbPath, cleanup := createTestDatabase(t)
+	defer cleanup()
+
+	bookmarks, err := GetBookmarks(dbPath)
+	if err != nil {
+		t.Fatalf("GetBookmarks failed: %v", err)
+	}
+
+	for _, bm := range bookmarks {
+		switch bm.VolumeID {
+		case "vol1":
+			if bm.Book.Title != "Sample Book" || bm.Book.Author != "Jane Doe" {
+				t.Errorf("Expected book metadata from content table, got %+v", bm.Book)
+			}
+			if bm.Book.Publisher != "Sample Press" || bm.Book.ISBN != "9780000000001" {
+				t.Errorf("Expected publisher and ISBN from content table, got %+v", bm.Book)
+			}
+			if bm.Book.Language != "en" || bm.Book.Series != "Samples" {
+				t.Errorf("Expected language and series from content table, got %+v", bm.Book)
+			}
+		case "vol2":
+			// No content row, metadata should be empty but the volume kept
+			if bm.Book.Title != "" || bm.Book.VolumeID != "vol2" {
+				t.Errorf("Expected empty metadata for volume without content row, got %+v", bm.Book)
+			}
+		}
+	}
+}
+
+func TestGetBookmarksDateModified(t *testing.T) {
+	dbPath, cleanup := createTestDatabase(t)
+	defer cleanup()
+
+	bookmarks, err := GetBookmarks(dbPath)
+	if err != nil {
+		t.Fatalf("GetBookmarks failed: %v", err)
+	}
+
+	for _, bm := range bookmarks {
+		switch bm.BookmarkID {
+		case "bm1":
+			if bm.DateModified != "2023-02-01T12:00:00Z" {
+				t.Errorf("Expected DateModified from the Bookmark table, got '%s'", bm.DateModified)
+			}
+		default:
+			// Never modified bookmarks fall back to their creation date
+			if bm.DateModified != bm.DateCreated {
+				t.Errorf("Expected NULL DateModified to fall back to DateCreated for %s, got '%s'", bm.BookmarkID, bm.DateModified)
+			}
+		}
+	}
+}
+
 func TestGetBookmarksWithEmptyDB(t *testing.T) {
 	// Create a temporary directory for our empty test database
 	tempDir, err := os.MkdirTemp("", "kobo_empty_test")
@@ -134,7 +212,22 @@ func TestGetBookmarksWithEmptyDB(t *testing.T) {
 			Annotation TEXT,
 			Type TEXT,
 			DateCreated TEXT,
-			Color TEXT
+			DateModified TEXT,
+			Color TEXT,
+			ContentID TEXT,
+			StartContainerPath TEXT,
+			StartOffset INTEGER,
+			ChapterProgress REAL
+		);
+		CREATE TABLE content (
+			ContentID TEXT PRIMARY KEY,
+			Title TEXT,
+			Attribution TEXT,
+			Publisher TEXT,
+			ISBN TEXT,
+			Language TEXT,
+			Series TEXT,
+			VolumeIndex INTEGER
 		);
 	`)
 	if err != nil {
@@ -162,3 +255,115 @@ func TestGetBookmarksWithInvalidPath(t *testing.T) {
 		t.Error("Expected error with invalid database path, got nil")
 	}
 }
+
+func TestGetBookmarksChapters(t *testing.T) {
+	dbPath, cleanup := createTestDatabase(t)
+	defer cleanup()
+
+	bookmarks, err := GetBookmarks(dbPath)
+	if err != nil {
+		t.Fatalf("GetBookmarks failed: %v", err)
+	}
+
+	for _, bm := range bookmarks {
+		switch bm.BookmarkID {
+		case "bm1":
+			if bm.ChapterTitle != "Chapter Two" || bm.ChapterIndex != 2 {
+				t.Errorf("Expected chapter title and index from the chapter row, got %q %d", bm.ChapterTitle, bm.ChapterIndex)
+			}
+		case "bm2":
+			// The chapter row has no title, the table of contents entry does
+			if bm.ChapterTitle != "Chapter One" || bm.ChapterIndex != 1 {
+				t.Errorf("Expected chapter title from the table of contents, got %q %d", bm.ChapterTitle, bm.ChapterIndex)
+			}
+		default:
+			if bm.ChapterTitle != "" || bm.ChapterIndex != -1 {
+				t.Errorf("Expected unknown chapter for %s, got %q %d", bm.BookmarkID, bm.ChapterTitle, bm.ChapterIndex)
+			}
+		}
+	}
+}
+
+func TestGetBookmarksDogEars(t *testing.T) {
+	dbPath, cleanup := createTestDatabase(t)
+	defer cleanup()
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO Bookmark (BookmarkID, VolumeID, Type, DateCreated, ContentID, ChapterProgress) VALUES
+		('dogear', 'vol1', 'dogear', '2023-01-06T12:00:00Z', 'vol1!OEBPS!ch2.xhtml', 0.454);
+	`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to insert dog-ear: %v", err)
+	}
+
+	bookmarks, err := GetBookmarks(dbPath)
+	if err != nil {
+		t.Fatalf("GetBookmarks failed: %v", err)
+	}
+
+	highlights, dogEars := SplitDogEars(bookmarks)
+	if len(dogEars) != 1 || dogEars[0].BookmarkID != "dogear" {
+		t.Fatalf("Expected the dog-ear without text to be read, got %v", dogEars)
+	}
+	if location := dogEars[0].Location(); location != "Chapter Two (45%)" {
+		t.Errorf("Location() = %q, want %q", location, "Chapter Two (45%)")
+	}
+
+	filtered := FilterTypes(bookmarks, []string{TypeHighlight, TypeNote})
+	if len(filtered) != len(highlights) {
+		t.Errorf("Expected FilterTypes to drop the dog-ear, got %d of %d bookmarks", len(filtered), len(bookmarks))
+	}
+}
+
+func TestSortByPosition(t *testing.T) {
+	bookmarks := []Bookmark{
+		{BookmarkID: "unknown", ChapterIndex: -1, DateCreated: "2023-01-01T12:00:00Z"},
+		{BookmarkID: "ch2", ChapterIndex: 2, ContentID: "ch2", StartContainerPath: "span#kobo\\.1\\.1"},
+		{BookmarkID: "ch1-late", ChapterIndex: 1, ContentID: "ch1", StartContainerPath: "span#kobo\\.10\\.1"},
+		{BookmarkID: "ch1-early", ChapterIndex: 1, ContentID: "ch1", StartContainerPath: "span#kobo\\.9\\.4"},
+	}
+
+	SortByPosition(bookmarks)
+
+	expected := []string{"ch1-early", "ch1-late", "ch2", "unknown"}
+	for i, bm := range bookmarks {
+		if bm.BookmarkID != expected[i] {
+			t.Fatalf("Expected order %v, got %s at %d", expected, bm.BookmarkID, i)
+		}
+	}
+}
+
+func TestSortBookmarks(t *testing.T) {
+	bookmarks := []Bookmark{
+		{BookmarkID: "ch1-offset-9", ChapterIndex: 1, ContentID: "ch1", StartContainerPath: "span#kobo\\.4\\.1", StartOffset: 9, DateCreated: "2023-01-03T12:00:00Z"},
+		{BookmarkID: "ch2", ChapterIndex: 2, ContentID: "ch2", DateCreated: "2023-01-01T12:00:00Z"},
+		{BookmarkID: "ch1-offset-2", ChapterIndex: 1, ContentID: "ch1", StartContainerPath: "span#kobo\\.4\\.1", StartOffset: 2, DateCreated: "2023-01-02T12:00:00Z"},
+	}
+
+	tests := []struct {
+		order    string
+		expected []string
+	}{
+		{OrderPosition, []string{"ch1-offset-2", "ch1-offset-9", "ch2"}},
+		{OrderCreatedAsc, []string{"ch2", "ch1-offset-2", "ch1-offset-9"}},
+		{OrderCreatedDesc, []string{"ch1-offset-9", "ch1-offset-2", "ch2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			sorted := append([]Bookmark(nil), bookmarks...)
+			SortBookmarks(sorted, tt.order)
+
+			for i, bm := range sorted {
+				if bm.BookmarkID != tt.expected[i] {
+					t.Fatalf("Expected order %v, got %s at %d", tt.expected, bm.BookmarkID, i)
+				}
+			}
+		})
+	}
+}
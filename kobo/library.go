@@ -0,0 +1,104 @@
+package kobo
+
+import (
+	"database/sql"
+	"slices"
+	"strings"
+)
+
+// BookFilter selects books of the library by read status and shelf. Statuses are
+// the lower case names of read statuses, and empty lists match every book.
+type BookFilter struct {
+	Statuses []string
+	Shelves  []string
+}
+
+// Match reports whether a book passes the filter. Books without reading progress are unread.
+func (f BookFilter) Match(book Book) bool {
+	status := ReadingStats{}.Status()
+	if book.Reading != nil {
+		status = book.Reading.Status()
+	}
+	if len(f.Statuses) > 0 && !slices.Contains(f.Statuses, strings.ToLower(status)) {
+		return false
+	}
+
+	if len(f.Shelves) > 0 && !slices.ContainsFunc(book.Shelves, func(shelf string) bool {
+		return slices.ContainsFunc(f.Shelves, func(name string) bool { return strings.EqualFold(name, shelf) })
+	}) {
+		return false
+	}
+
+	return true
+}
+
+// GetBooks reads every book of the Kobo library with its reading progress and shelves,
+// whether it has bookmarks or not
+func GetBooks(dbPath string) ([]Book, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	books, err := queryBooks(db)
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := queryReadingStats(db)
+	if err != nil {
+		return nil, err
+	}
+
+	shelves, err := queryShelves(db)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range books {
+		if rs, ok := stats[books[i].VolumeID]; ok {
+			books[i].Reading = &rs
+		}
+		books[i].Shelves = shelves[books[i].VolumeID]
+	}
+
+	return books, nil
+}
+
+func queryBooks(db *sql.DB) ([]Book, error) {
+	query := `
+    SELECT
+      c.ContentID,
+      IFNULL(c.Title, '') AS Title,
+      IFNULL(c.Attribution, '') AS Attribution,
+      IFNULL(c.Publisher, '') AS Publisher,
+      IFNULL(c.ISBN, '') AS ISBN,
+      IFNULL(c.Language, '') AS Language,
+      IFNULL(c.Series, '') AS Series
+    FROM content c
+    WHERE c.ContentType = 6
+    ORDER BY c.ContentID;
+    `
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var books []Book
+	for rows.Next() {
+		var book Book
+		if err := rows.Scan(&book.VolumeID, &book.Title, &book.Author, &book.Publisher, &book.ISBN, &book.Language, &book.Series); err != nil {
+			return nil, err
+		}
+		books = append(books, book)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return books, nil
+}
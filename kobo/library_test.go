@@ -0,0 +1,113 @@
+package kobo
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func createLibraryDatabase(t *testing.T) string {
+	dbPath := createStatsDatabase(t)
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+		ALTER TABLE content ADD COLUMN Attribution TEXT;
+		ALTER TABLE content ADD COLUMN Publisher TEXT;
+		ALTER TABLE content ADD COLUMN ISBN TEXT;
+		ALTER TABLE content ADD COLUMN Language TEXT;
+		ALTER TABLE content ADD COLUMN Series TEXT;
+		UPDATE content SET Attribution = 'Jane Doe' WHERE ContentID = 'vol1';
+		CREATE TABLE ShelfContent (
+			ShelfName TEXT,
+			ContentId TEXT,
+			DateModified TEXT,
+			_IsDeleted TEXT,
+			_IsSynced TEXT
+		);
+		CREATE TABLE Shelf (
+			Id TEXT,
+			InternalName TEXT,
+			Name TEXT,
+			_IsDeleted TEXT
+		);
+		INSERT INTO ShelfContent (ShelfName, ContentId, _IsDeleted) VALUES
+		('Work', 'vol1', 'false'),
+		('Book Club', 'vol1', 'false'),
+		('Work', 'vol2', 'true'),
+		('Old', 'vol2', 'false'),
+		('Book Club', 'vol3', 'false'),
+		('Holiday', 'vol3', 'false');
+		INSERT INTO Shelf (Id, InternalName, Name, _IsDeleted) VALUES
+		('1', 'Work', 'Work', 'false'),
+		('2', 'Book Club', 'Book Club', 'false'),
+		('3', 'Old', 'Old', 'true'),
+		('4', 'Holiday', 'Summer Reading', 'false');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create test data: %v", err)
+	}
+
+	return dbPath
+}
+
+func TestGetBooks(t *testing.T) {
+	books, err := GetBooks(createLibraryDatabase(t))
+	if err != nil {
+		t.Fatalf("GetBooks failed: %v", err)
+	}
+
+	// Chapter rows are not books
+	if len(books) != 3 {
+		t.Fatalf("Expected 3 books, got %d", len(books))
+	}
+
+	book := books[0]
+	if book.VolumeID != "vol1" || book.Title != "Reading Book" || book.Author != "Jane Doe" {
+		t.Errorf("Unexpected metadata: %+v", book)
+	}
+	if book.Reading == nil || book.Reading.PercentRead != 45 {
+		t.Errorf("Expected reading progress, got %+v", book.Reading)
+	}
+	if !reflect.DeepEqual(book.Shelves, []string{"Book Club", "Work"}) {
+		t.Errorf("Expected shelves in name order, got %v", book.Shelves)
+	}
+
+	// Books removed from a shelf are no longer on it
+	if len(books[1].Shelves) != 0 {
+		t.Errorf("Expected no shelves for vol2, got %v", books[1].Shelves)
+	}
+}
+
+func TestBookFilterMatch(t *testing.T) {
+	reading := Book{Reading: &ReadingStats{ReadStatus: ReadStatusReading}, Shelves: []string{"Work"}}
+	finished := Book{Reading: &ReadingStats{ReadStatus: ReadStatusFinished}}
+	unknown := Book{}
+
+	tests := []struct {
+		name   string
+		filter BookFilter
+		book   Book
+		want   bool
+	}{
+		{"empty filter", BookFilter{}, unknown, true},
+		{"status", BookFilter{Statuses: []string{"reading"}}, reading, true},
+		{"other status", BookFilter{Statuses: []string{"reading"}}, finished, false},
+		{"no progress is unread", BookFilter{Statuses: []string{"unread"}}, unknown, true},
+		{"shelf ignores case", BookFilter{Shelves: []string{"work"}}, reading, true},
+		{"not on shelf", BookFilter{Shelves: []string{"Work"}}, finished, false},
+		{"status and shelf", BookFilter{Statuses: []string{"finished"}, Shelves: []string{"Work"}}, reading, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Match(tt.book); got != tt.want {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
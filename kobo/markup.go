@@ -0,0 +1,108 @@
+package kobo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MarkupsDir returns the folder holding the markup files, next to the Kobo database
+func MarkupsDir(dbPath string) string {
+	return filepath.Join(filepath.Dir(dbPath), "markups")
+}
+
+// CompositeMarkup returns an SVG image of a markup, its strokes drawn over the page they were
+// made on. The Kobo stores the strokes as <BookmarkID>.svg and the page as <BookmarkID>.jpg,
+// either may be missing. Both are embedded so the image is a single self-contained file.
+func CompositeMarkup(dir string, bookmarkID string) ([]byte, error) {
+	page, pageErr := os.ReadFile(filepath.Join(dir, bookmarkID+".jpg"))
+	strokes, strokesErr := os.ReadFile(filepath.Join(dir, bookmarkID+".svg"))
+	if pageErr != nil && strokesErr != nil {
+		return nil, fmt.Errorf("no markup files for %s: %w", bookmarkID, errors.Join(pageErr, strokesErr))
+	}
+
+	var width, height int
+	var err error
+	if pageErr == nil {
+		width, height, err = jpegSize(page)
+	} else {
+		width, height, err = svgSize(strokes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading markup %s: %w", bookmarkID, err)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", width, height, width, height)
+	if pageErr == nil {
+		writeEmbeddedImage(&b, "image/jpeg", page, width, height)
+	}
+	if strokesErr == nil {
+		writeEmbeddedImage(&b, "image/svg+xml", strokes, width, height)
+	}
+	b.WriteString("</svg>\n")
+
+	return b.Bytes(), nil
+}
+
+// writeEmbeddedImage writes an image element holding data covering the whole composite
+func writeEmbeddedImage(b *bytes.Buffer, mediaType string, data []byte, width int, height int) {
+	fmt.Fprintf(b, `  <image width="%d" height="%d" href="data:%s;base64,%s"/>`+"\n", width, height, mediaType, base64.StdEncoding.EncodeToString(data))
+}
+
+// jpegSize returns the size of a JPEG image
+func jpegSize(data []byte) (int, int, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
+
+// svgSize returns the size of an SVG image from its width and height, or its view box
+func svgSize(data []byte) (int, int, error) {
+	var root struct {
+		Width   string `xml:"width,attr"`
+		Height  string `xml:"height,attr"`
+		ViewBox string `xml:"viewBox,attr"`
+	}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return 0, 0, err
+	}
+
+	width, widthErr := svgLength(root.Width)
+	height, heightErr := svgLength(root.Height)
+	if widthErr == nil && heightErr == nil {
+		return width, height, nil
+	}
+
+	if box := strings.Fields(strings.ReplaceAll(root.ViewBox, ",", " ")); len(box) == 4 {
+		width, widthErr = svgLength(box[2])
+		height, heightErr = svgLength(box[3])
+		if widthErr == nil && heightErr == nil {
+			return width, height, nil
+		}
+	}
+
+	return 0, 0, errors.New("svg has no size")
+}
+
+// svgLength parses an SVG length in pixels, rounded to the nearest pixel
+func svgLength(value string) (int, error) {
+	length, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(value), "px"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if length <= 0 {
+		return 0, fmt.Errorf("invalid length %q", value)
+	}
+	return int(length + 0.5), nil
+}
@@ -0,0 +1,63 @@
+package kobo
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeMarkupFiles(t *testing.T, dir string, bookmarkID string, withPage bool) {
+	t.Helper()
+
+	strokes := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 60 80"><path d="M0 0L10 10"/></svg>`
+	if err := os.WriteFile(filepath.Join(dir, bookmarkID+".svg"), []byte(strokes), 0644); err != nil {
+		t.Fatalf("Failed to write strokes: %v", err)
+	}
+
+	if withPage {
+		var page bytes.Buffer
+		if err := jpeg.Encode(&page, image.NewGray(image.Rect(0, 0, 30, 40)), nil); err != nil {
+			t.Fatalf("Failed to encode page: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, bookmarkID+".jpg"), page.Bytes(), 0644); err != nil {
+			t.Fatalf("Failed to write page: %v", err)
+		}
+	}
+}
+
+func TestCompositeMarkup(t *testing.T) {
+	dir := t.TempDir()
+	writeMarkupFiles(t, dir, "with-page", true)
+	writeMarkupFiles(t, dir, "strokes-only", false)
+
+	tests := []struct {
+		bookmarkID string
+		expected   []string
+	}{
+		// The page sets the size, the strokes are scaled over it
+		{"with-page", []string{`width="30" height="40"`, "data:image/jpeg;base64,", "data:image/svg+xml;base64,"}},
+		{"strokes-only", []string{`width="60" height="80"`, "data:image/svg+xml;base64,"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.bookmarkID, func(t *testing.T) {
+			composite, err := CompositeMarkup(dir, tt.bookmarkID)
+			if err != nil {
+				t.Fatalf("CompositeMarkup() error = %v", err)
+			}
+			for _, expected := range tt.expected {
+				if !strings.Contains(string(composite), expected) {
+					t.Errorf("Expected composite to contain %q, got:\n%s", expected, composite)
+				}
+			}
+		})
+	}
+
+	if _, err := CompositeMarkup(dir, "missing"); err == nil {
+		t.Error("Expected an error for a markup without files")
+	}
+}
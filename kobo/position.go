@@ -0,0 +1,116 @@
+package kobo
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Orders the bookmarks of a book can be sorted in
+const (
+	OrderPosition    = "position"
+	OrderCreatedAsc  = "created_asc"
+	OrderCreatedDesc = "created_desc"
+)
+
+// SortBookmarks orders the bookmarks of a book, by position unless another order is given
+func SortBookmarks(bookmarks []Bookmark, order string) {
+	slices.SortStableFunc(bookmarks, CompareFunc(order))
+}
+
+// CompareFunc returns the comparison of two bookmarks of the same book in an order
+func CompareFunc(order string) func(a, b Bookmark) int {
+	switch order {
+	case OrderCreatedAsc:
+		return compareCreated
+	case OrderCreatedDesc:
+		return func(a, b Bookmark) int {
+			return compareCreated(b, a)
+		}
+	default:
+		return ComparePosition
+	}
+}
+
+// compareCreated compares the creation date of two bookmarks, then their position
+func compareCreated(a, b Bookmark) int {
+	if c := strings.Compare(a.DateCreated, b.DateCreated); c != 0 {
+		return c
+	}
+	return ComparePosition(a, b)
+}
+
+// SortByPosition orders the bookmarks of a book by where they are in it: by chapter,
+// then by position in the chapter. Bookmarks in unknown chapters come last.
+func SortByPosition(bookmarks []Bookmark) {
+	slices.SortStableFunc(bookmarks, ComparePosition)
+}
+
+// ComparePosition compares the position of two bookmarks of the same book
+func ComparePosition(a, b Bookmark) int {
+	if a.ChapterIndex != b.ChapterIndex {
+		switch {
+		case a.ChapterIndex < 0:
+			return 1
+		case b.ChapterIndex < 0:
+			return -1
+		}
+		return cmp.Compare(a.ChapterIndex, b.ChapterIndex)
+	}
+
+	// Chapters of unknown order still keep their bookmarks together
+	if c := strings.Compare(a.ContentID, b.ContentID); c != 0 {
+		return c
+	}
+
+	if c := compareContainerPaths(a.StartContainerPath, b.StartContainerPath); c != 0 {
+		return c
+	}
+
+	if c := cmp.Compare(a.StartOffset, b.StartOffset); c != 0 {
+		return c
+	}
+
+	return strings.Compare(a.DateCreated, b.DateCreated)
+}
+
+// compareContainerPaths compares two StartContainerPath values such as "span#kobo\.12\.3"
+// or "/1/4/2/1:0", reading the numbers they contain as numbers rather than text
+func compareContainerPaths(a, b string) int {
+	partsA, partsB := splitNumbers(a), splitNumbers(b)
+
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		numA, errA := strconv.Atoi(partsA[i])
+		numB, errB := strconv.Atoi(partsB[i])
+
+		var c int
+		if errA == nil && errB == nil {
+			c = cmp.Compare(numA, numB)
+		} else {
+			c = strings.Compare(partsA[i], partsB[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+
+	return cmp.Compare(len(partsA), len(partsB))
+}
+
+// splitNumbers splits a string into runs of digits and runs of other characters
+func splitNumbers(value string) []string {
+	var parts []string
+	start := 0
+	for i, r := range value {
+		digit := r >= '0' && r <= '9'
+		if i > start && digit != (value[i-1] >= '0' && value[i-1] <= '9') {
+			parts = append(parts, value[start:i])
+			start = i
+		}
+	}
+	if start < len(value) {
+		parts = append(parts, value[start:])
+	}
+	return parts
+}
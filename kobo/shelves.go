@@ -0,0 +1,58 @@
+package kobo
+
+import "database/sql"
+
+// GetShelves reads the shelves (collections) each book of a Kobo database is on, by volume ID
+func GetShelves(dbPath string) (map[string][]string, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return queryShelves(db)
+}
+
+func queryShelves(db *sql.DB) (map[string][]string, error) {
+	// ShelfContent refers to shelves by their internal name, Shelf holds the name shown on
+	// the device, which changes when a shelf is renamed. Books removed from a shelf and
+	// deleted shelves stay in both tables, flagged as deleted.
+	query := `
+    SELECT
+      sc.ContentId,
+      IFNULL(NULLIF(s.Name, ''), sc.ShelfName) AS ShelfName
+    FROM ShelfContent sc
+    LEFT JOIN Shelf s ON s.InternalName = sc.ShelfName
+    WHERE IFNULL(sc._IsDeleted, 'false') != 'true'
+      AND IFNULL(s._IsDeleted, 'false') != 'true'
+    ORDER BY ShelfName;
+    `
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shelves := make(map[string][]string)
+	for rows.Next() {
+		var volumeID, shelf string
+		if err := rows.Scan(&volumeID, &shelf); err != nil {
+			return nil, err
+		}
+		shelves[volumeID] = append(shelves[volumeID], shelf)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return shelves, nil
+}
+
+// ApplyShelves sets the shelves of the book of each bookmark
+func ApplyShelves(bookmarks []Bookmark, shelves map[string][]string) {
+	for i := range bookmarks {
+		bookmarks[i].Book.Shelves = shelves[bookmarks[i].VolumeID]
+	}
+}
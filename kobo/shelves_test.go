@@ -0,0 +1,40 @@
+package kobo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetShelves(t *testing.T) {
+	shelves, err := GetShelves(createLibraryDatabase(t))
+	if err != nil {
+		t.Fatalf("GetShelves failed: %v", err)
+	}
+
+	if !reflect.DeepEqual(shelves["vol1"], []string{"Book Club", "Work"}) {
+		t.Errorf("Expected shelves in name order, got %v", shelves["vol1"])
+	}
+
+	// Books removed from a shelf and deleted shelves are left out
+	if _, ok := shelves["vol2"]; ok {
+		t.Errorf("Expected no shelves for vol2, got %v", shelves["vol2"])
+	}
+
+	// Renamed shelves keep their internal name in ShelfContent
+	if !reflect.DeepEqual(shelves["vol3"], []string{"Book Club", "Summer Reading"}) {
+		t.Errorf("Expected the shown name of renamed shelves, got %v", shelves["vol3"])
+	}
+}
+
+func TestApplyShelves(t *testing.T) {
+	bookmarks := []Bookmark{{BookmarkID: "bm1", VolumeID: "vol1"}, {BookmarkID: "bm2", VolumeID: "sideloaded"}}
+
+	ApplyShelves(bookmarks, map[string][]string{"vol1": {"Work"}})
+
+	if !reflect.DeepEqual(bookmarks[0].Book.Shelves, []string{"Work"}) {
+		t.Errorf("Expected the shelves of vol1, got %v", bookmarks[0].Book.Shelves)
+	}
+	if bookmarks[1].Book.Shelves != nil {
+		t.Errorf("Expected no shelves for a book on none, got %v", bookmarks[1].Book.Shelves)
+	}
+}
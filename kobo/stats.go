@@ -0,0 +1,117 @@
+package kobo
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Read statuses Kobo stores in the ReadStatus column of a book
+const (
+	ReadStatusUnread   = 0
+	ReadStatusReading  = 1
+	ReadStatusFinished = 2
+)
+
+// ReadingStats holds the reading progress Kobo tracks for a book
+type ReadingStats struct {
+	// PercentRead is how far into the book the reader is, from 0 to 100
+	PercentRead int
+	ReadStatus  int
+	TimeSpent   time.Duration
+	// LastRead is when the book was last read, empty when never opened
+	LastRead string
+	// FirstOpened and LastOpened come from the reading events of the book
+	FirstOpened string
+	LastOpened  string
+}
+
+// Status names the read status of a book
+func (r ReadingStats) Status() string {
+	switch r.ReadStatus {
+	case ReadStatusReading:
+		return "Reading"
+	case ReadStatusFinished:
+		return "Finished"
+	default:
+		return "Unread"
+	}
+}
+
+// Finished returns when a finished book was finished, Kobo stops updating its last read date
+// once it is. It is empty for books still being read.
+func (r ReadingStats) Finished() string {
+	if r.ReadStatus != ReadStatusFinished {
+		return ""
+	}
+	return r.LastRead
+}
+
+// GetReadingStats reads the reading progress of every book in a Kobo database, by volume ID
+func GetReadingStats(dbPath string) (map[string]ReadingStats, error) {
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return queryReadingStats(db)
+}
+
+func queryReadingStats(db *sql.DB) (map[string]ReadingStats, error) {
+	// Books are the content rows of type 6. Every reading session is recorded in the
+	// Event table, the first and last occurrence of any event tell when a book was opened.
+	query := `
+    SELECT
+      c.ContentID,
+      IFNULL(c.___PercentRead, 0) AS PercentRead,
+      IFNULL(c.ReadStatus, 0) AS ReadStatus,
+      IFNULL(c.TimeSpentReading, 0) AS TimeSpentReading,
+      IFNULL(c.DateLastRead, '') AS DateLastRead,
+      IFNULL(e.FirstOpened, '') AS FirstOpened,
+      IFNULL(e.LastOpened, '') AS LastOpened
+    FROM content c
+    LEFT JOIN (
+      SELECT ContentID, MIN(FirstOccurrence) AS FirstOpened, MAX(LastOccurrence) AS LastOpened
+      FROM Event
+      GROUP BY ContentID
+    ) e ON e.ContentID = c.ContentID
+    WHERE c.ContentType = 6;
+    `
+
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := make(map[string]ReadingStats)
+	for rows.Next() {
+		var volumeID string
+		var seconds int64
+		var rs ReadingStats
+		if err := rows.Scan(&volumeID, &rs.PercentRead, &rs.ReadStatus, &seconds, &rs.LastRead, &rs.FirstOpened, &rs.LastOpened); err != nil {
+			return nil, err
+		}
+		rs.TimeSpent = time.Duration(seconds) * time.Second
+		if rs.LastRead == "" {
+			rs.LastRead = rs.LastOpened
+		}
+		stats[volumeID] = rs
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// ApplyReadingStats sets the reading progress of the book of each bookmark. Books missing
+// from stats, such as sideloaded files Kobo never indexed, are left without progress.
+func ApplyReadingStats(bookmarks []Bookmark, stats map[string]ReadingStats) {
+	for i := range bookmarks {
+		if rs, ok := stats[bookmarks[i].VolumeID]; ok {
+			bookmarks[i].Book.Reading = &rs
+		}
+	}
+}
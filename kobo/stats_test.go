@@ -0,0 +1,101 @@
+package kobo
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func createStatsDatabase(t *testing.T) string {
+	dbPath := filepath.Join(t.TempDir(), "KoboReader.sqlite")
+
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatalf("Failed to open test database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE content (
+			ContentID TEXT PRIMARY KEY,
+			ContentType INTEGER,
+			Title TEXT,
+			___PercentRead INTEGER,
+			ReadStatus INTEGER,
+			TimeSpentReading INTEGER,
+			DateLastRead TEXT
+		);
+		CREATE TABLE Event (
+			EventType INTEGER,
+			FirstOccurrence TEXT,
+			LastOccurrence TEXT,
+			EventCount INTEGER,
+			ContentID TEXT
+		);
+		INSERT INTO content (ContentID, ContentType, Title, ___PercentRead, ReadStatus, TimeSpentReading, DateLastRead) VALUES
+		('vol1', 6, 'Reading Book', 45, 1, 5400, '2023-03-01T20:00:00Z'),
+		('vol2', 6, 'Finished Book', 100, 2, 36000, '2023-02-01T21:30:00Z'),
+		('vol3', 6, 'Opened Book', NULL, 1, NULL, NULL),
+		('vol1!OEBPS!ch1.xhtml', 9, 'Chapter One', 100, 2, NULL, NULL);
+		INSERT INTO Event (EventType, FirstOccurrence, LastOccurrence, EventCount, ContentID) VALUES
+		(46, '2023-01-10T08:00:00Z', '2023-03-01T20:00:00Z', 12, 'vol1'),
+		(3, '2023-01-05T08:00:00Z', '2023-02-20T08:00:00Z', 1, 'vol1'),
+		(46, '2023-01-20T08:00:00Z', '2023-01-22T08:00:00Z', 2, 'vol3');
+	`)
+	if err != nil {
+		t.Fatalf("Failed to create test data: %v", err)
+	}
+
+	return dbPath
+}
+
+func TestGetReadingStats(t *testing.T) {
+	stats, err := GetReadingStats(createStatsDatabase(t))
+	if err != nil {
+		t.Fatalf("GetReadingStats failed: %v", err)
+	}
+
+	// Chapter rows are not books
+	if len(stats) != 3 {
+		t.Fatalf("Expected stats for 3 books, got %d: %v", len(stats), stats)
+	}
+
+	reading := stats["vol1"]
+	if reading.PercentRead != 45 || reading.Status() != "Reading" || reading.TimeSpent != 90*time.Minute {
+		t.Errorf("Unexpected progress of the book being read: %+v", reading)
+	}
+	if reading.FirstOpened != "2023-01-05T08:00:00Z" || reading.LastOpened != "2023-03-01T20:00:00Z" {
+		t.Errorf("Expected first and last opened from all events, got %q and %q", reading.FirstOpened, reading.LastOpened)
+	}
+	if reading.Finished() != "" {
+		t.Errorf("Expected no finished date for a book being read, got %q", reading.Finished())
+	}
+
+	finished := stats["vol2"]
+	if finished.Status() != "Finished" || finished.Finished() != "2023-02-01T21:30:00Z" {
+		t.Errorf("Expected the last read date as finished date, got %+v", finished)
+	}
+	if finished.FirstOpened != "" {
+		t.Errorf("Expected no first opened date without events, got %q", finished.FirstOpened)
+	}
+
+	// Books without a last read date fall back to their last reading event
+	opened := stats["vol3"]
+	if opened.LastRead != "2023-01-22T08:00:00Z" || opened.PercentRead != 0 || opened.TimeSpent != 0 {
+		t.Errorf("Unexpected progress of the opened book: %+v", opened)
+	}
+}
+
+func TestApplyReadingStats(t *testing.T) {
+	bookmarks := []Bookmark{{BookmarkID: "bm1", VolumeID: "vol1"}, {BookmarkID: "bm2", VolumeID: "sideloaded"}}
+
+	ApplyReadingStats(bookmarks, map[string]ReadingStats{"vol1": {PercentRead: 45}})
+
+	if bookmarks[0].Book.Reading == nil || bookmarks[0].Book.Reading.PercentRead != 45 {
+		t.Errorf("Expected the progress of vol1, got %+v", bookmarks[0].Book.Reading)
+	}
+	if bookmarks[1].Book.Reading != nil {
+		t.Errorf("Expected no progress for a book without stats, got %+v", bookmarks[1].Book.Reading)
+	}
+}
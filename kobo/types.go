@@ -0,0 +1,61 @@
+package kobo
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Bookmark types stored by the Kobo
+const (
+	// TypeHighlight is highlighted text
+	TypeHighlight = "highlight"
+	// TypeNote is highlighted text with an annotation
+	TypeNote = "note"
+	// TypeDogEar is a page bookmark, it has no text
+	TypeDogEar = "dogear"
+	// TypeMarkup is a handwritten markup drawn on a page
+	TypeMarkup = "markup"
+)
+
+// IsDogEar reports whether a bookmark marks a page rather than highlighting text
+func (b Bookmark) IsDogEar() bool {
+	return b.Type == TypeDogEar
+}
+
+// IsMarkup reports whether a bookmark is a handwritten markup
+func (b Bookmark) IsMarkup() bool {
+	return b.Type == TypeMarkup
+}
+
+// Location describes where a bookmark is, as its chapter and how far into it
+func (b Bookmark) Location() string {
+	chapter := b.ChapterTitle
+	if chapter == "" {
+		chapter = "Untitled chapter"
+	}
+	return fmt.Sprintf("%s (%d%%)", chapter, int(math.Round(b.ChapterProgress*100)))
+}
+
+// FilterTypes returns the bookmarks of the given types, keeping their order
+func FilterTypes(bookmarks []Bookmark, types []string) []Bookmark {
+	filtered := make([]Bookmark, 0, len(bookmarks))
+	for _, bookmark := range bookmarks {
+		if slices.Contains(types, bookmark.Type) {
+			filtered = append(filtered, bookmark)
+		}
+	}
+	return filtered
+}
+
+// SplitDogEars separates the dog-ears of bookmarks from their highlights
+func SplitDogEars(bookmarks []Bookmark) (highlights []Bookmark, dogEars []Bookmark) {
+	for _, bookmark := range bookmarks {
+		if bookmark.IsDogEar() {
+			dogEars = append(dogEars, bookmark)
+		} else {
+			highlights = append(highlights, bookmark)
+		}
+	}
+	return highlights, dogEars
+}
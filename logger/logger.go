@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -12,6 +13,18 @@ var (
 	LogFile *os.File
 )
 
+// Verbosity levels controlling what is logged besides the log file
+const (
+	// LevelQuiet only writes to the log file
+	LevelQuiet = iota
+	// LevelNormal also prints to stdout
+	LevelNormal
+	// LevelVerbose also logs debug messages
+	LevelVerbose
+)
+
+var level = LevelNormal
+
 func Init(logFilePath string) error {
 	dir := filepath.Dir(logFilePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -24,8 +37,7 @@ func Init(logFilePath string) error {
 	}
 	LogFile = file
 
-	multiWriter := io.MultiWriter(os.Stdout, file)
-	Logger = log.New(multiWriter, "", log.Ldate|log.Ltime|log.Lshortfile)
+	Logger = log.New(output(file), "", log.Ldate|log.Ltime|log.Lshortfile)
 	
 	Logger.Println("Logger initialized successfully")
 	return nil
@@ -35,4 +47,28 @@ func Close() {
 	if LogFile != nil {
 		LogFile.Close()
 	}
-}
\ No newline at end of file
+}
+
+// SetLevel changes the verbosity of the logger, before or after Init
+func SetLevel(newLevel int) {
+	level = newLevel
+	if Logger != nil && LogFile != nil {
+		Logger.SetOutput(output(LogFile))
+	}
+}
+
+// Debugf logs a message only in verbose mode
+func Debugf(format string, v ...any) {
+	if level < LevelVerbose || Logger == nil {
+		return
+	}
+	Logger.Output(2, fmt.Sprintf(format, v...))
+}
+
+// output returns where log messages are written for the current level
+func output(file *os.File) io.Writer {
+	if level == LevelQuiet {
+		return file
+	}
+	return io.MultiWriter(os.Stdout, file)
+}
@@ -227,4 +227,32 @@ func TestLoggerOutput(t *testing.T) {
 	
 	// Clean up
 	os.RemoveAll(tempDir)
-}
\ No newline at end of file
+}
+func TestDebugfOnlyWhenVerbose(t *testing.T) {
+	tempDir := t.TempDir()
+	logPath := filepath.Join(tempDir, "debug_test.log")
+
+	err := Init(logPath)
+	if err != nil {
+		t.Fatalf("Init failed: %v", err)
+	}
+	defer SetLevel(LevelNormal)
+
+	Debugf("hidden %s", "message")
+	SetLevel(LevelVerbose)
+	Debugf("verbose %s", "message")
+
+	Close()
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+
+	if strings.Contains(string(content), "hidden message") {
+		t.Error("Debug message was logged without verbose mode")
+	}
+	if !strings.Contains(string(content), "verbose message") {
+		t.Error("Debug message was not logged in verbose mode")
+	}
+}
@@ -0,0 +1,325 @@
+package markdown
+
+/*
+Package markdown exports bookmarks to a folder of Markdown files, one per book,
+usable as an Obsidian vault. Files are rewritten on every export, except for the
+text below NotesMarker which belongs to the user.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"kobo-to-notion/config"
+	"kobo-to-notion/kobo"
+	"kobo-to-notion/logger"
+	"kobo-to-notion/utils"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NotesMarker separates the exported highlights from notes added by the user
+const NotesMarker = "<!-- kobo-to-notion: notes below this line are kept between exports -->"
+
+// MarkupsFolder is the folder of the export holding the images of handwritten markups
+const MarkupsFolder = "markups"
+
+// ExportOptions holds the optional settings of an export
+type ExportOptions struct {
+	// MarkupsDir is the folder holding the markup files of the Kobo. Markups are left out
+	// when it is empty or their files cannot be read.
+	MarkupsDir string
+	// ColorNames names the highlight colours listed in the front matter, by colour index.
+	// The default colour names are used when it is nil.
+	ColorNames map[string]string
+	// SortOrder is the order of the highlights of a book, in reading order when empty.
+	// Chapter headings are only written in reading order, like on Notion pages.
+	SortOrder string
+}
+
+// ExportBookmarks writes one Markdown file per book to dir, grouping bookmarks like
+// the grouped Notion sync. Files whose content is unchanged are left untouched.
+func ExportBookmarks(dir string, bookmarks []kobo.Bookmark) error {
+	return ExportBookmarksWithOptions(dir, bookmarks, ExportOptions{})
+}
+
+// ExportBookmarksWithOptions exports bookmarks like ExportBookmarks, writing the markups
+// found in the markups folder as SVG images next to the Markdown files
+func ExportBookmarksWithOptions(dir string, bookmarks []kobo.Bookmark, options ExportOptions) error {
+	colorNames := options.ColorNames
+	if colorNames == nil {
+		colorNames = config.DefaultColorNames()
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	markups, err := exportMarkups(filepath.Join(dir, MarkupsFolder), options.MarkupsDir, bookmarks)
+	if err != nil {
+		return err
+	}
+
+	// Group bookmarks by book, books sharing a title are exported apart
+	bookmarksByBook := make(map[string][]kobo.Bookmark)
+	var volumeIDs []string
+	for _, bookmark := range bookmarks {
+		if _, exists := bookmarksByBook[bookmark.VolumeID]; !exists {
+			volumeIDs = append(volumeIDs, bookmark.VolumeID)
+		}
+		bookmarksByBook[bookmark.VolumeID] = append(bookmarksByBook[bookmark.VolumeID], bookmark)
+	}
+
+	bookNames := make(map[string]string)
+	titles := make(map[string]int)
+	for _, volumeID := range volumeIDs {
+		bookNames[volumeID] = utils.GetBookName(bookmarksByBook[volumeID][0])
+		titles[bookNames[volumeID]]++
+	}
+	sort.Slice(volumeIDs, func(i, j int) bool {
+		if bookNames[volumeIDs[i]] != bookNames[volumeIDs[j]] {
+			return bookNames[volumeIDs[i]] < bookNames[volumeIDs[j]]
+		}
+		return volumeIDs[i] < volumeIDs[j]
+	})
+
+	written := 0
+	for _, volumeID := range volumeIDs {
+		bookName := bookNames[volumeID]
+
+		// Files of books sharing a title also carry the name of the book file
+		fileName := bookName
+		if titles[bookName] > 1 {
+			fileName = fmt.Sprintf("%s (%s)", bookName, utils.GetBookNameFromVolumeID(volumeID))
+		}
+		path := filepath.Join(dir, FileName(fileName))
+
+		changed, err := writeBookFile(path, renderBook(bookName, bookmarksByBook[volumeID], markups, colorNames, options.SortOrder))
+		if err != nil {
+			return fmt.Errorf("exporting %s: %w", bookName, err)
+		}
+		if changed {
+			written++
+		}
+	}
+
+	logger.Logger.Printf("Exported %d books to %s, %d files changed\n", len(volumeIDs), dir, written)
+	return nil
+}
+
+// FileName returns the Markdown file name of a book, without characters file systems reject
+func FileName(bookName string) string {
+	name := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '-'
+		}
+		if r < 0x20 {
+			return -1
+		}
+		return r
+	}, bookName)
+
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if name == "" {
+		name = "Untitled"
+	}
+	return name + ".md"
+}
+
+// exportMarkups writes the image of each markup to dir and returns the IDs of the markups written
+func exportMarkups(dir string, markupsDir string, bookmarks []kobo.Bookmark) (map[string]bool, error) {
+	exported := make(map[string]bool)
+	if markupsDir == "" {
+		return exported, nil
+	}
+
+	for _, bookmark := range bookmarks {
+		if !bookmark.IsMarkup() {
+			continue
+		}
+
+		image, err := kobo.CompositeMarkup(markupsDir, bookmark.BookmarkID)
+		if err != nil {
+			logger.Logger.Printf("Warning: skipping markup %s: %v\n", bookmark.BookmarkID, err)
+			continue
+		}
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, err
+		}
+
+		path := filepath.Join(dir, bookmark.BookmarkID+".svg")
+		if existing, err := os.ReadFile(path); err != nil || !bytes.Equal(existing, image) {
+			if err := os.WriteFile(path, image, 0644); err != nil {
+				return nil, fmt.Errorf("exporting markup %s: %w", bookmark.BookmarkID, err)
+			}
+		}
+		exported[bookmark.BookmarkID] = true
+	}
+
+	return exported, nil
+}
+
+// writeBookFile writes the exported content of a book, keeping the user notes below the marker.
+// It reports whether the file changed.
+func writeBookFile(path string, content string) (bool, error) {
+	notes := "\n"
+
+	existing, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		if _, after, found := bytes.Cut(existing, []byte(NotesMarker)); found {
+			notes = string(after)
+		}
+	case !os.IsNotExist(err):
+		return false, err
+	}
+
+	updated := []byte(content + NotesMarker + notes)
+	if bytes.Equal(existing, updated) {
+		return false, nil
+	}
+
+	return true, os.WriteFile(path, updated, 0644)
+}
+
+// renderBook renders the front matter and highlights of a book, linking the exported markups
+func renderBook(bookName string, bookmarks []kobo.Bookmark, markups map[string]bool, colorNames map[string]string, order string) string {
+	var b strings.Builder
+	book := bookmarks[0].Book
+
+	b.WriteString("---\n")
+	writeYAMLString(&b, "title", bookName)
+	writeYAMLString(&b, "author", book.Author)
+	writeYAMLString(&b, "publisher", book.Publisher)
+	writeYAMLString(&b, "isbn", book.ISBN)
+	writeYAMLString(&b, "language", book.Language)
+	writeYAMLString(&b, "series", book.Series)
+
+	created, modified := bookmarkDates(bookmarks)
+	writeYAMLString(&b, "created", created)
+	writeYAMLString(&b, "modified", modified)
+
+	if colors := bookmarkColors(bookmarks, colorNames); len(colors) > 0 {
+		b.WriteString("colors:\n")
+		for _, color := range colors {
+			quoted, _ := json.Marshal(color)
+			fmt.Fprintf(&b, "  - %s\n", quoted)
+		}
+	}
+	// Dog-ears mark pages, they are listed after the highlights
+	highlights, dogEars := kobo.SplitDogEars(bookmarks)
+
+	fmt.Fprintf(&b, "highlights: %d\n", len(highlights))
+	b.WriteString("---\n\n")
+
+	fmt.Fprintf(&b, "# %s\n\n", bookName)
+
+	// In reading order a heading is written before the first highlight of each titled chapter
+	highlights = slices.Clone(highlights)
+	kobo.SortBookmarks(highlights, order)
+	withHeadings := order == "" || order == kobo.OrderPosition
+	chapters := make(map[string]bool)
+
+	for _, bookmark := range highlights {
+		if withHeadings && bookmark.ChapterTitle != "" && !chapters[bookmark.ContentID] {
+			chapters[bookmark.ContentID] = true
+			fmt.Fprintf(&b, "## %s\n\n", bookmark.ChapterTitle)
+		}
+
+		if bookmark.IsMarkup() && bookmark.Text == "" && bookmark.Annotation == "" {
+			if markups[bookmark.BookmarkID] {
+				fmt.Fprintf(&b, "![Markup](%s/%s.svg)\n\n", MarkupsFolder, bookmark.BookmarkID)
+			}
+			continue
+		}
+
+		if bookmark.Text != "" {
+			writeQuoted(&b, "> ", bookmark.Text)
+		}
+
+		// Annotations are nested under their highlight
+		if bookmark.Annotation != "" {
+			if bookmark.Text != "" {
+				b.WriteString(">\n")
+				writeQuoted(&b, "> > ", bookmark.Annotation)
+			} else {
+				writeQuoted(&b, "> ", bookmark.Annotation)
+			}
+		}
+
+		b.WriteString("\n")
+	}
+
+	if len(dogEars) > 0 {
+		kobo.SortByPosition(dogEars)
+		b.WriteString("## Bookmarked locations\n\n")
+		for _, bookmark := range dogEars {
+			fmt.Fprintf(&b, "- %s\n", bookmark.Location())
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// writeQuoted writes text as blockquote lines with the given prefix
+func writeQuoted(b *strings.Builder, prefix string, text string) {
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		b.WriteString(strings.TrimRight(prefix+strings.TrimSpace(line), " "))
+		b.WriteString("\n")
+	}
+}
+
+// writeYAMLString writes a front matter field, skipping empty values. Values are
+// written as JSON strings, which YAML reads as double quoted scalars.
+func writeYAMLString(b *strings.Builder, key string, value string) {
+	if value == "" {
+		return
+	}
+
+	quoted, _ := json.Marshal(value)
+	fmt.Fprintf(b, "%s: %s\n", key, quoted)
+}
+
+// bookmarkDates returns the earliest creation and latest modification dates of the bookmarks
+func bookmarkDates(bookmarks []kobo.Bookmark) (string, string) {
+	var created, modified time.Time
+
+	for _, bookmark := range bookmarks {
+		if date, err := utils.ParseKoboBookmarkDate(bookmark.DateCreated); err == nil {
+			if created.IsZero() || date.Before(created) {
+				created = date
+			}
+		}
+		if date, err := utils.ParseKoboBookmarkDate(bookmark.DateModified); err == nil {
+			if date.After(modified) {
+				modified = date
+			}
+		}
+	}
+
+	return formatDate(created), formatDate(modified)
+}
+
+// formatDate formats a date for the front matter, zero dates are left empty
+func formatDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+	return date.UTC().Format(time.RFC3339)
+}
+
+// bookmarkColors returns the names of the highlight colours used in the bookmarks, in colour order
+func bookmarkColors(bookmarks []kobo.Bookmark, colorNames map[string]string) []string {
+	var colors []string
+	for _, bookmark := range bookmarks {
+		colors = append(colors, bookmark.Color)
+	}
+	return config.ColorCategories(colors, colorNames)
+}
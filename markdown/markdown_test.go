@@ -0,0 +1,295 @@
+package markdown
+
+import (
+	"kobo-to-notion/config"
+	"kobo-to-notion/kobo"
+	"kobo-to-notion/logger"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setupLogger(t *testing.T) {
+	if err := logger.Init(filepath.Join(t.TempDir(), "test.log")); err != nil {
+		t.Fatalf("Failed to initialize logger: %v", err)
+	}
+	t.Cleanup(logger.Close)
+}
+
+func testBookmarks() []kobo.Bookmark {
+	book := kobo.Book{Title: "Sample Book", Author: "Jane Doe", ISBN: "9780000000001"}
+	return []kobo.Bookmark{
+		{
+			BookmarkID:   "bm1",
+			VolumeID:     "file:///mnt/onboard/sample.epub",
+			Text:         "First highlight",
+			Annotation:   "A note on it",
+			DateCreated:  "2023-01-02T12:00:00Z",
+			DateModified: "2023-02-01T12:00:00Z",
+			Color:        "2",
+			Book:         book,
+		},
+		{
+			BookmarkID:   "bm2",
+			VolumeID:     "file:///mnt/onboard/sample.epub",
+			Text:         "Second highlight",
+			DateCreated:  "2023-01-01T12:00:00Z",
+			DateModified: "2023-01-01T12:00:00Z",
+			Color:        "0",
+			Book:         book,
+		},
+	}
+}
+
+func TestExportBookmarks(t *testing.T) {
+	setupLogger(t)
+	dir := t.TempDir()
+
+	if err := ExportBookmarks(dir, testBookmarks()); err != nil {
+		t.Fatalf("ExportBookmarks failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "Sample Book.md"))
+	if err != nil {
+		t.Fatalf("Failed to read exported file: %v", err)
+	}
+
+	for _, expected := range []string{
+		"---\ntitle: \"Sample Book\"\nauthor: \"Jane Doe\"\n",
+		"created: \"2023-01-01T12:00:00Z\"\nmodified: \"2023-02-01T12:00:00Z\"\n",
+		"colors:\n  - \"Yellow\"\n  - \"Blue\"\n",
+		"> First highlight\n>\n> > A note on it\n",
+		"> Second highlight\n",
+		NotesMarker,
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected exported file to contain %q, got:\n%s", expected, content)
+		}
+	}
+}
+
+func TestExportBookmarksSharingATitle(t *testing.T) {
+	setupLogger(t)
+	dir := t.TempDir()
+
+	bookmarks := testBookmarks()
+	bookmarks[1].VolumeID = "file:///mnt/onboard/sample-second-edition.epub"
+
+	if err := ExportBookmarks(dir, bookmarks); err != nil {
+		t.Fatalf("ExportBookmarks failed: %v", err)
+	}
+
+	for name, expected := range map[string]string{
+		"Sample Book (sample).md":                "> First highlight\n",
+		"Sample Book (sample-second-edition).md": "> Second highlight\n",
+	} {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Failed to read exported file %s: %v", name, err)
+		}
+		if !strings.Contains(string(content), expected) || strings.Count(string(content), "highlight\n") != 1 {
+			t.Errorf("Expected %s to only hold %q, got:\n%s", name, expected, content)
+		}
+	}
+}
+
+func TestExportBookmarksDogEars(t *testing.T) {
+	setupLogger(t)
+	dir := t.TempDir()
+
+	bookmarks := testBookmarks()
+	bookmarks = append(bookmarks, kobo.Bookmark{
+		BookmarkID:      "dogear",
+		VolumeID:        "file:///mnt/onboard/sample.epub",
+		Type:            kobo.TypeDogEar,
+		DateCreated:     "2023-01-03T12:00:00Z",
+		ChapterTitle:    "Chapter Two",
+		ChapterProgress: 0.5,
+		Book:            bookmarks[0].Book,
+	})
+
+	if err := ExportBookmarks(dir, bookmarks); err != nil {
+		t.Fatalf("ExportBookmarks failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "Sample Book.md"))
+	if err != nil {
+		t.Fatalf("Failed to read exported file: %v", err)
+	}
+
+	for _, expected := range []string{
+		"highlights: 2\n",
+		"> > A note on it\n\n## Bookmarked locations\n\n- Chapter Two (50%)\n",
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("Expected exported file to contain %q, got:\n%s", expected, content)
+		}
+	}
+}
+
+func TestExportBookmarksSortOrder(t *testing.T) {
+	setupLogger(t)
+
+	bookmarks := testBookmarks()
+	bookmarks[0].ContentID, bookmarks[0].ChapterIndex, bookmarks[0].ChapterTitle = "sample!ch1", 1, "Chapter One"
+	bookmarks[1].ContentID, bookmarks[1].ChapterIndex, bookmarks[1].ChapterTitle = "sample!ch2", 2, "Chapter Two"
+
+	for _, test := range []struct {
+		order    string
+		expected string
+	}{
+		{kobo.OrderPosition, "## Chapter One\n\n> First highlight\n>\n> > A note on it\n\n## Chapter Two\n\n> Second highlight\n"},
+		{kobo.OrderCreatedAsc, "# Sample Book\n\n> Second highlight\n\n> First highlight\n"},
+		{kobo.OrderCreatedDesc, "# Sample Book\n\n> First highlight\n>\n> > A note on it\n\n> Second highlight\n"},
+	} {
+		dir := t.TempDir()
+		if err := ExportBookmarksWithOptions(dir, bookmarks, ExportOptions{SortOrder: test.order}); err != nil {
+			t.Fatalf("ExportBookmarksWithOptions failed: %v", err)
+		}
+
+		content, err := os.ReadFile(filepath.Join(dir, "Sample Book.md"))
+		if err != nil {
+			t.Fatalf("Failed to read exported file: %v", err)
+		}
+		if !strings.Contains(string(content), test.expected) {
+			t.Errorf("Expected %s export to contain %q, got:\n%s", test.order, test.expected, content)
+		}
+		if test.order != kobo.OrderPosition && strings.Contains(string(content), "## Chapter") {
+			t.Errorf("Expected no chapter headings in %s order, got:\n%s", test.order, content)
+		}
+	}
+}
+
+func TestExportBookmarksColorNames(t *testing.T) {
+	setupLogger(t)
+	dir := t.TempDir()
+
+	// Colours are named like in Notion, yellow is left out
+	colorNames := map[string]string{"1": "Quote", "2": "Idea"}
+	if err := ExportBookmarksWithOptions(dir, testBookmarks(), ExportOptions{ColorNames: colorNames}); err != nil {
+		t.Fatalf("ExportBookmarksWithOptions failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "Sample Book.md"))
+	if err != nil {
+		t.Fatalf("Failed to read exported file: %v", err)
+	}
+	if !strings.Contains(string(content), "colors:\n  - \"Idea\"\nhighlights:") {
+		t.Errorf("Expected the configured colour names, got:\n%s", content)
+	}
+}
+
+func TestExportBookmarksWithMarkups(t *testing.T) {
+	setupLogger(t)
+	dir := t.TempDir()
+	markupsDir := t.TempDir()
+
+	strokes := `<svg xmlns="http://www.w3.org/2000/svg" width="60" height="80"></svg>`
+	if err := os.WriteFile(filepath.Join(markupsDir, "drawn.svg"), []byte(strokes), 0644); err != nil {
+		t.Fatalf("Failed to write markup: %v", err)
+	}
+
+	bookmarks := testBookmarks()
+	for _, id := range []string{"drawn", "lost"} {
+		bookmarks = append(bookmarks, kobo.Bookmark{
+			BookmarkID:  id,
+			VolumeID:    "file:///mnt/onboard/sample.epub",
+			Type:        kobo.TypeMarkup,
+			DateCreated: "2023-01-03T12:00:00Z",
+			Book:        bookmarks[0].Book,
+		})
+	}
+
+	if err := ExportBookmarksWithOptions(dir, bookmarks, ExportOptions{MarkupsDir: markupsDir}); err != nil {
+		t.Fatalf("ExportBookmarksWithOptions failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, MarkupsFolder, "drawn.svg")); err != nil {
+		t.Errorf("Expected the markup image to be exported: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, "Sample Book.md"))
+	if err != nil {
+		t.Fatalf("Failed to read exported file: %v", err)
+	}
+	if !strings.Contains(string(content), "![Markup](markups/drawn.svg)\n") {
+		t.Errorf("Expected a link to the markup image, got:\n%s", content)
+	}
+	if strings.Contains(string(content), "lost") {
+		t.Errorf("Expected markups without files to be left out, got:\n%s", content)
+	}
+}
+
+func TestExportBookmarksKeepsUserNotes(t *testing.T) {
+	setupLogger(t)
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Sample Book.md")
+
+	if err := ExportBookmarks(dir, testBookmarks()); err != nil {
+		t.Fatalf("ExportBookmarks failed: %v", err)
+	}
+
+	content, _ := os.ReadFile(path)
+	userNotes := "\nMy thoughts on this book.\n"
+	if err := os.WriteFile(path, append(content[:len(content)-1], userNotes...), 0644); err != nil {
+		t.Fatalf("Failed to add user notes: %v", err)
+	}
+
+	bookmarks := testBookmarks()
+	bookmarks[1].Text = "Second highlight, edited"
+	if err := ExportBookmarks(dir, bookmarks); err != nil {
+		t.Fatalf("ExportBookmarks failed: %v", err)
+	}
+
+	content, _ = os.ReadFile(path)
+	if !strings.Contains(string(content), "> Second highlight, edited\n") {
+		t.Errorf("Expected edited highlight in exported file, got:\n%s", content)
+	}
+	if !strings.HasSuffix(string(content), NotesMarker+userNotes) {
+		t.Errorf("Expected user notes to be kept below the marker, got:\n%s", content)
+	}
+}
+
+func TestExportBookmarksIsIdempotent(t *testing.T) {
+	setupLogger(t)
+	dir := t.TempDir()
+
+	if err := ExportBookmarks(dir, testBookmarks()); err != nil {
+		t.Fatalf("ExportBookmarks failed: %v", err)
+	}
+
+	path := filepath.Join(dir, "Sample Book.md")
+	first, _ := os.ReadFile(path)
+
+	changed, err := writeBookFile(path, renderBook("Sample Book", testBookmarks(), nil, config.DefaultColorNames(), kobo.OrderPosition))
+	if err != nil {
+		t.Fatalf("writeBookFile failed: %v", err)
+	}
+	if changed {
+		t.Error("Expected unchanged bookmarks to leave the file untouched")
+	}
+
+	second, _ := os.ReadFile(path)
+	if string(first) != string(second) {
+		t.Errorf("Expected identical files, got:\n%s\nand:\n%s", first, second)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	tests := []struct {
+		bookName string
+		expected string
+	}{
+		{"Sample Book", "Sample Book.md"},
+		{"Part 1: The Beginning", "Part 1- The Beginning.md"},
+		{"AC/DC?", "AC-DC-.md"},
+		{"  ", "Untitled.md"},
+	}
+
+	for _, test := range tests {
+		if result := FileName(test.bookName); result != test.expected {
+			t.Errorf("FileName(%q) = %q, expected %q", test.bookName, result, test.expected)
+		}
+	}
+}
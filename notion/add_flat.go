@@ -0,0 +1,73 @@
+package notion
+
+import (
+	"errors"
+	"kobo-to-notion/config"
+	"kobo-to-notion/kobo"
+	"kobo-to-notion/logger"
+	"kobo-to-notion/utils"
+
+	"github.com/jomei/notionapi"
+)
+
+// AddBookmarksFlat adds every bookmark as its own database row, skipping bookmarks already in Notion
+func (s *NotionService) AddBookmarksFlat(databaseID string, bookmarks []kobo.Bookmark) error {
+	plan, err := s.PlanBookmarksFlat(databaseID, bookmarks)
+	if err != nil {
+		return err
+	}
+
+	return s.ApplyPlan(plan)
+}
+
+// PlanBookmarksFlat computes the rows to create for bookmarks not yet in the database
+func (s *NotionService) PlanBookmarksFlat(databaseID string, bookmarks []kobo.Bookmark) (*Plan, error) {
+	bookmarks = syncedBookmarks(bookmarks)
+
+	// Get bookmark IDs already in the database
+	existingBookmarks, err := s.GetBookmarkIDs(databaseID)
+	if err != nil {
+		return nil, err
+	}
+
+	newBookmarks := utils.FilterNewBookmarks(bookmarks, existingBookmarks)
+	logger.Logger.Printf("Found %d new bookmarks out of %d\n", len(newBookmarks), len(bookmarks))
+
+	plan := &Plan{
+		DatabaseID: databaseID,
+		Mode:       PlanModeFlat,
+		bookmarks:  bookmarks,
+	}
+
+	for _, bookmark := range newBookmarks {
+		plan.Pages = append(plan.Pages, planBookPageCreation(utils.GetBookName(bookmark), []kobo.Bookmark{bookmark}))
+	}
+
+	return plan, nil
+}
+
+// createBookmarkPage creates a database row holding a single bookmark
+func (s *NotionService) createBookmarkPage(databaseID string, bookmark kobo.Bookmark) error {
+	if bookmark.BookmarkID == "" {
+		return errors.New("bookmark without ID")
+	}
+
+	parsedDate, err := utils.ParseKoboBookmarkDate(bookmark.DateCreated)
+	if err != nil {
+		return err
+	}
+
+	values := bookmarkFieldValues(bookmark, s.colorNames)
+	values[config.FieldCreated] = parsedDate
+
+	payload := &notionapi.PageCreateRequest{
+		Parent: notionapi.Parent{
+			DatabaseID: notionapi.DatabaseID(databaseID),
+		},
+		Properties: s.buildProperties(values, PlanModeFlat),
+		Children:   s.renderer.Render(bookmark),
+	}
+
+	_, err = s.pageClient.Create(s.contextFunc(), payload)
+	return err
+}
@@ -1,206 +1,793 @@
 package notion
 
 import (
-	"errors"
+	"fmt"
+	"kobo-to-notion/config"
 	"kobo-to-notion/kobo"
 	"kobo-to-notion/logger"
+	"kobo-to-notion/state"
 	"kobo-to-notion/utils"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/jomei/notionapi"
 )
 
 // AddBookmarks adds multiple bookmarks to Notion in a batch
 func (s *NotionService) AddBookmarks(databaseID string, bookmarks []kobo.Bookmark) error {
-	// Group bookmarks by book name
+	plan, err := s.PlanBookmarks(databaseID, bookmarks)
+	if err != nil {
+		return err
+	}
+
+	return s.ApplyPlan(plan)
+}
+
+// PlanBookmarks computes the changes needed to sync bookmarks grouped by book. Pages
+// may be read to match their blocks, but nothing is written to Notion or the state store.
+func (s *NotionService) PlanBookmarks(databaseID string, bookmarks []kobo.Bookmark) (*Plan, error) {
+	bookmarks = syncedBookmarks(bookmarks)
+
+	// Group bookmarks by book, books sharing a title are told apart by their volume ID
 	bookmarksByBook := make(map[string][]kobo.Bookmark)
+	books := make(map[string]kobo.Book)
 	for _, bookmark := range bookmarks {
-		bookName := utils.GetBookNameFromVolumeID(bookmark.VolumeID)
-		bookmarksByBook[bookName] = append(bookmarksByBook[bookName], bookmark)
+		bookmarksByBook[bookmark.VolumeID] = append(bookmarksByBook[bookmark.VolumeID], bookmark)
+		books[bookmark.VolumeID] = bookOf(bookmark)
 	}
 
-	// Get existing pages by book name
-	bookPages, err := s.GetPagesByBookName(databaseID)
+	// Books of the library may have no highlights
+	for _, book := range s.library {
+		if _, exists := books[book.VolumeID]; !exists {
+			books[book.VolumeID] = book
+		}
+	}
+
+	// Books are processed by title
+	volumeIDs := sortedKeys(books)
+	slices.SortStableFunc(volumeIDs, func(a, b string) int {
+		return strings.Compare(utils.GetBookTitle(books[a]), utils.GetBookTitle(books[b]))
+	})
+
+	// Get the existing pages and the book each one belongs to
+	pages, err := s.queryBookPages(databaseID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	bookPages := s.matchBookPages(volumeIDs, books, bookmarksByBook, pages)
 
-	// Process each book
-	for bookName, bookBookmarks := range bookmarksByBook {
-		logger.Logger.Printf("Processing book: %s\n", bookName)
+	plan := &Plan{
+		DatabaseID: databaseID,
+		Mode:       PlanModeGrouped,
+		bookmarks:  bookmarks,
+		bookPages:  make(map[string]string),
+	}
 
-		if pageID, exists := bookPages[bookName]; exists {
-			err = s.updateBookPage(pageID, bookBookmarks)
-			if err != nil {
-				logger.Logger.Printf("Error updating page for book %s: %v", bookName, err)
-				continue
-			}
-		} else {
-			err = s.createBookPageWithBookmarks(databaseID, bookBookmarks)
-			if err != nil {
-				logger.Logger.Printf("Error creating page for book %s: %v", bookName, err)
+	// Pages matched to a book in this run, they must not be archived
+	syncedPages := make(map[notionapi.PageID]bool)
+
+	// Pages that lost bookmarks since the last sync have to be revisited
+	pagesWithRemovals := s.pagesWithRemovedBookmarks(bookmarks)
+
+	// Process each book
+	for _, volumeID := range volumeIDs {
+		book := books[volumeID]
+		bookName := utils.GetBookTitle(book)
+		bookBookmarks := bookmarksByBook[volumeID]
+
+		match, exists := bookPages[volumeID]
+		if !exists {
+			// Only books matching the library filter get a page without highlights
+			if len(bookBookmarks) == 0 && !s.mirror.Match(book) {
 				continue
 			}
+
+			plan.Pages = append(plan.Pages, PageChange{
+				Action:    PageCreate,
+				Book:      bookName,
+				Blocks:    s.addBlockChanges(s.sortBookmarks(bookBookmarks)),
+				book:      book,
+				bookmarks: bookBookmarks,
+			})
+			continue
 		}
 
-		logger.Logger.Printf("Successfully processed book: %s\n", bookName)
+		pageID, renameFrom := match.id, match.renameFrom
+		syncedPages[pageID] = true
+		plan.bookPages[volumeID] = string(pageID)
+
+		// Reading progress changes without any highlight changing
+		if renameFrom == "" && !s.fullSync && !s.bookChanged(bookBookmarks, pagesWithRemovals[pageID]) &&
+			!s.pagePropertiesChanged(pageID, propertiesHash(s.bookPageProperties(book, bookBookmarks))) {
+			plan.SkippedBooks++
+			continue
+		}
+
+		change, err := s.planBookPage(pageID, book, bookBookmarks)
+		if err != nil {
+			logger.Logger.Printf("Error reading page for book %s: %v", bookName, err)
+			plan.Errors = append(plan.Errors, fmt.Sprintf("%s: %v", bookName, err))
+			continue
+		}
+
+		change.Book = bookName
+		change.RenameFrom = renameFrom
+		change.PropertiesChanged = change.PropertiesChanged || renameFrom != ""
+		plan.Pages = append(plan.Pages, change)
+	}
+
+	for pageID := range syncedPages {
+		plan.foundPages = append(plan.foundPages, string(pageID))
+	}
+
+	// Pages of books removed from the Kobo go through the deletion policy
+	for _, page := range pages {
+		if syncedPages[page.id] {
+			continue
+		}
+
+		if change, planned := s.planMissingPage(page.title, page.id); planned {
+			plan.Pages = append(plan.Pages, change)
+		}
+	}
+
+	if err := s.checkRemovals(plan, len(pages)); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// bookPageMatch is the existing page of a book
+type bookPageMatch struct {
+	id notionapi.PageID
+	// renameFrom is the file name the page is titled after, when it was matched by it
+	renameFrom string
+}
+
+// matchBookPages finds the existing page of each book. Pages recorded for a book, or
+// holding its synced bookmarks, are matched first, so books sharing a title keep their own
+// page. Other books take the first page left with their title, or with their file name for
+// pages created before the content table was read.
+func (s *NotionService) matchBookPages(volumeIDs []string, books map[string]kobo.Book, bookmarksByBook map[string][]kobo.Bookmark, pages []bookPage) map[string]bookPageMatch {
+	inDatabase := make(map[notionapi.PageID]bool)
+	for _, page := range pages {
+		inDatabase[page.id] = true
 	}
 
-	// Remove deleted books from notion
-	for bookName, pageID := range bookPages {
-		if bookmarks, exists := bookmarksByBook[bookName]; !exists {
-			if len(bookmarks) != 0 {
+	matches := make(map[string]bookPageMatch)
+	taken := make(map[notionapi.PageID]bool)
+	for _, volumeID := range volumeIDs {
+		pageID := notionapi.PageID(s.knownBookPage(volumeID, bookmarksByBook[volumeID]))
+		if inDatabase[pageID] && !taken[pageID] {
+			matches[volumeID] = bookPageMatch{id: pageID}
+			taken[pageID] = true
+		}
+	}
+
+	for _, volumeID := range volumeIDs {
+		if _, matched := matches[volumeID]; matched {
+			continue
+		}
+
+		bookName := utils.GetBookTitle(books[volumeID])
+		legacyName := utils.GetBookNameFromVolumeID(volumeID)
+		for _, page := range pages {
+			if taken[page.id] || (page.title != bookName && page.title != legacyName) {
 				continue
 			}
 
-			logger.Logger.Printf("Removing book page for book: %s\n", bookName)
-			err := s.ArchivePage(databaseID, pageID)
-			if err != nil {
-				logger.Logger.Printf("Error removing page for book %s: %v", bookName, err)
-				continue
+			match := bookPageMatch{id: page.id}
+			if page.title != bookName {
+				match.renameFrom = legacyName
 			}
+			matches[volumeID] = match
+			taken[page.id] = true
+			break
 		}
 	}
 
-	return nil
+	return matches
 }
 
-// updateBookPage updates an existing page with new bookmarks, replacing all content
-func (s *NotionService) updateBookPage(pageID notionapi.PageID, bookmarks []kobo.Bookmark) error {
-	if len(bookmarks) == 0 {
-		return errors.New("no bookmarks provided")
+// knownBookPage returns the page recorded for a book, or else the page its bookmarks were synced to
+func (s *NotionService) knownBookPage(volumeID string, bookmarks []kobo.Bookmark) string {
+	if pageID := s.store.BookPage(volumeID); pageID != "" {
+		return pageID
 	}
 
-	// First get the page to ensure it exists
-	_, err := s.pageClient.Get(s.contextFunc(), pageID)
-	if err != nil {
-		return err
+	for _, bookmark := range bookmarks {
+		if entry, ok := s.store.Get(bookmark.BookmarkID); ok {
+			return entry.PageID
+		}
 	}
+	return ""
+}
 
-	// Current blocks on the page
-	currentBlocks, err := s.getAllBlocksFromPage(pageID)
-	if err != nil {
-		logger.Logger.Printf("Warning: failed to get existing blocks: %v\n", err)
+// planBookPageCreation plans a new page holding all bookmarks of a book
+func planBookPageCreation(bookName string, bookmarks []kobo.Bookmark) PageChange {
+	change := PageChange{
+		Action:    PageCreate,
+		Book:      bookName,
+		bookmarks: bookmarks,
 	}
 
-	// Create blocks for all bookmarks, excluding already existing blocks
-	var allBlocks []notionapi.Block
 	for _, bookmark := range bookmarks {
-		// Skip if the bookmark is empty
-		if bookmark.Text != "" && !utils.ContainsBlockRichText(bookmark.Text, currentBlocks) {
-			blocks := s.createBookmarkTextBlocks(bookmark)
-			allBlocks = append(allBlocks, blocks...)
+		change.Blocks = append(change.Blocks, BlockChange{
+			Action:     BlockAdd,
+			BookmarkID: bookmark.BookmarkID,
+			Preview:    bookmarkPreview(bookmark),
+		})
+	}
+
+	return change
+}
+
+// planBookPage plans the update of an existing page. The state store maps each bookmark
+// to its blocks, so new highlights are inserted in order, edited ones updated in place,
+// deleted ones removed and unchanged ones cost no API calls. User blocks are never part
+// of the plan. Pages of library books may be left without bookmarks.
+func (s *NotionService) planBookPage(pageID notionapi.PageID, book kobo.Book, bookmarks []kobo.Bookmark) (PageChange, error) {
+	change := PageChange{
+		Action:    PageUpdate,
+		PageID:    string(pageID),
+		book:      book,
+		bookmarks: bookmarks,
+	}
+
+	change.propertiesHash = propertiesHash(s.bookPageProperties(book, bookmarks))
+	change.PropertiesChanged = s.pagePropertiesChanged(pageID, change.propertiesHash)
+
+	// Full syncs re-read the page to repair blocks changed or removed by hand
+	tracked := s.store.PageEntries(string(pageID))
+	headings := s.store.PageChapters(string(pageID))
+	if s.fullSync || needsAdoption(tracked) {
+		// First get the page to ensure it exists
+		_, err := s.pageClient.Get(s.contextFunc(), pageID)
+		if err != nil {
+			return change, err
 		}
 
-		// If bookmark text is already in the current blocks, skip
-		if bookmark.Annotation != "" && !utils.ContainsBlockRichText(bookmark.Annotation, currentBlocks) {
-			blocks := s.createBookmarkAnnotationBlocks(bookmark)
-			allBlocks = append(allBlocks, blocks...)
+		previous := tracked
+		var orphans []notionapi.BlockID
+		tracked, headings, orphans, err = s.adoptPageBlocks(pageID, bookmarks)
+		if err != nil {
+			return change, err
 		}
+		change.adopted = tracked
+		change.adoptedChapters = headings
+
+		// Blocks no bookmark ever owned may have been written by the user, they are never deleted
+		if untracked := keepTrackedBlocks(previous, tracked, orphans); len(untracked) > 0 {
+			logger.Debugf("Leaving %d synced-looking blocks no bookmark owns on page %s", len(untracked), pageID)
+		}
+	}
+
+	currentBookmarks := make(map[string]bool)
+	currentChapters := make(map[string]bool)
+	for _, bookmark := range bookmarks {
+		currentBookmarks[bookmark.BookmarkID] = true
+		if bookmark.IsDogEar() {
+			currentChapters[dogEarSectionID] = true
+		} else {
+			currentChapters[bookmark.ContentID] = true
+		}
+	}
+
+	layout, err := s.planPageLayout(pageID, bookmarks, tracked, headings)
+	if err != nil {
+		return change, err
 	}
+	change.Blocks = append(change.Blocks, layout...)
 
-	// Delete existing blocks that are not in the new blocks
-	var deletedBlocks []notionapi.BlockID
-	for _, block := range currentBlocks {
-		if utils.ContainsBookmark(block.GetRichTextString(), bookmarks) {
+	// Delete or mark the blocks of bookmarks removed from the Kobo
+	for _, bookmarkID := range sortedKeys(tracked) {
+		if currentBookmarks[bookmarkID] {
 			continue
 		}
 
-		blockID := block.GetID()
-		logger.Logger.Printf("Block does not exist in new blocks: %s\n", block.GetRichTextString())
+		change.Blocks = append(change.Blocks, s.removedBookmarkChanges(bookmarkID, tracked[bookmarkID])...)
+	}
 
-		_, err := s.blockClient.Delete(s.contextFunc(), blockID)
+	// Delete the headings of chapters left without bookmarks, kept over removed blocks
+	for _, chapterID := range sortedKeys(headings) {
+		if currentChapters[chapterID] || s.deletion.policy != config.DeletePolicyArchive {
+			continue
+		}
 
+		change.Blocks = append(change.Blocks, BlockChange{
+			Action:    BlockDelete,
+			ChapterID: chapterID,
+			BlockIDs:  []string{headings[chapterID]},
+		})
+	}
+
+	return change, nil
+}
+
+// layoutUnit is a bookmark or chapter heading in the order of the page
+type layoutUnit struct {
+	change BlockChange
+	// blockIDs are the blocks of the unit kept on the page, nil when it is written again
+	blockIDs []string
+}
+
+// planPageLayout plans the blocks of the bookmarks of a page in the sort order. Unchanged
+// and edited bookmarks keep their blocks, new ones are inserted after the synced block
+// preceding them. The Notion API can only insert after a block, so new blocks coming
+// before every synced one are inserted after the user block preceding them, or appended
+// to the page when there is none. Synced blocks are never written again to make room,
+// they would lose their comments and the blocks nested by the user.
+func (s *NotionService) planPageLayout(pageID notionapi.PageID, bookmarks []kobo.Bookmark, tracked map[string]state.Entry, headings map[string]string) ([]BlockChange, error) {
+	var units []layoutUnit
+	for _, change := range s.addBlockChanges(s.sortBookmarks(bookmarks)) {
+		unit := layoutUnit{change: change}
+
+		if change.ChapterID != "" {
+			if blockID, exists := headings[change.ChapterID]; exists {
+				unit.change.Action = ""
+				unit.blockIDs = []string{blockID}
+			}
+			units = append(units, unit)
+			continue
+		}
+
+		// Blocks rendered in another style cannot be updated and are replaced
+		entry, known := tracked[change.BookmarkID]
+		sameStyle := entryStyle(entry.Style) == s.renderer.Style()
+		switch {
+		case !known || len(entry.BlockIDs) == 0:
+		case entry.Hash == change.hash && sameStyle && !entry.Removed:
+			unit.change.Action = ""
+			unit.blockIDs = entry.BlockIDs
+		case sameStyle && canUpdateInPlace(change.blocks):
+			// Blocks both on the page and rendered are updated, a note added or grown gets
+			// its blocks inserted after them and the blocks of a removed note are deleted
+			kept := min(len(entry.BlockIDs), len(change.blocks))
+			unit.change.Action = BlockUpdate
+			unit.change.BlockIDs = entry.BlockIDs
+			unit.blockIDs = entry.BlockIDs[:kept]
+			if len(change.blocks) > kept {
+				unit.change.After = entry.BlockIDs[kept-1]
+			}
+		default:
+			unit.change.Action = BlockReplace
+			unit.change.BlockIDs = entry.BlockIDs
+		}
+		units = append(units, unit)
+	}
+
+	anchor := ""
+	first := slices.IndexFunc(units, func(unit layoutUnit) bool { return unit.blockIDs != nil })
+	if first > 0 {
+		var err error
+		anchor, err = s.leadingAnchor(pageID, units[first].blockIDs[0], headings)
 		if err != nil {
-			logger.Logger.Printf("Warning: could not delete block %s: %v\n", blockID, err)
+			return nil, err
+		}
+		if anchor == "" {
+			logger.Logger.Printf("Warning: no block precedes the synced ones on page %s, %d new blocks are appended out of order\n", pageID, first)
 		}
+	}
+
+	var changes []BlockChange
+	for _, unit := range units {
+		if unit.blockIDs != nil {
+			anchor = unit.blockIDs[len(unit.blockIDs)-1]
+			if unit.change.Action == BlockUpdate {
+				changes = append(changes, unit.change)
+			}
+			continue
+		}
+
+		unit.change.After = anchor
+		changes = append(changes, unit.change)
+	}
+
+	return changes, nil
+}
+
+// leadingAnchor returns the nearest block preceding the first synced block of a page that
+// the sync did not write, new blocks inserted after it come before every synced one. It is
+// empty when only synced blocks precede it.
+func (s *NotionService) leadingAnchor(pageID notionapi.PageID, firstBlockID string, headings map[string]string) (string, error) {
+	blocks, err := s.getAllBlocksFromPage(pageID)
+	if err != nil {
+		return "", err
+	}
+
+	syncedHeadings := make(map[string]bool, len(headings))
+	for _, blockID := range headings {
+		syncedHeadings[blockID] = true
+	}
 
-		logger.Logger.Printf("Deleted block %s\n", blockID)
-		deletedBlocks = append(deletedBlocks, blockID)
+	first := slices.IndexFunc(blocks, func(block notionapi.Block) bool { return string(block.GetID()) == firstBlockID })
+	for i := first - 1; i >= 0; i-- {
+		blockID := string(blocks[i].GetID())
+		if !isSyncedBlock(blocks[i]) && !syncedHeadings[blockID] {
+			return blockID, nil
+		}
 	}
 
-	if len(deletedBlocks) > 0 {
-		logger.Logger.Printf("Page deleted blocks: %d\n", len(deletedBlocks))
+	return "", nil
+}
+
+// addBlockChanges plans the blocks of bookmarks, given in the sort order. In reading order
+// a heading is added before the first bookmark of each titled chapter, other orders mix
+// chapters and have no headings. Dog-ears follow the highlights in their own section.
+func (s *NotionService) addBlockChanges(bookmarks []kobo.Bookmark) []BlockChange {
+	var changes []BlockChange
+	added := make(map[string]bool)
+	withHeadings := s.sortOrder == kobo.OrderPosition
+	highlights, dogEars := kobo.SplitDogEars(bookmarks)
+
+	for _, bookmark := range highlights {
+		chapterID := bookmark.ContentID
+		if withHeadings && bookmark.ChapterTitle != "" && !added[chapterID] {
+			added[chapterID] = true
+			changes = append(changes, BlockChange{
+				Action:    BlockAdd,
+				ChapterID: chapterID,
+				Chapter:   bookmark.ChapterTitle,
+				blocks:    []notionapi.Block{createChapterHeading(bookmark.ChapterTitle)},
+			})
+		}
+
+		changes = append(changes, s.bookmarkChange(bookmark))
 	}
 
-	// Create new blocks
-	if len(allBlocks) > 0 {
-		_, err = s.blockClient.AppendChildren(s.contextFunc(), notionapi.BlockID(pageID), &notionapi.AppendBlockChildrenRequest{
-			Children: allBlocks,
+	if len(dogEars) > 0 {
+		changes = append(changes, BlockChange{
+			Action:    BlockAdd,
+			ChapterID: dogEarSectionID,
+			Chapter:   dogEarSectionTitle,
+			blocks:    []notionapi.Block{createChapterHeading(dogEarSectionTitle)},
 		})
+		for _, bookmark := range byPosition(dogEars) {
+			changes = append(changes, s.bookmarkChange(bookmark))
+		}
+	}
+
+	return changes
+}
+
+// bookmarkChange plans the blocks of a bookmark
+func (s *NotionService) bookmarkChange(bookmark kobo.Bookmark) BlockChange {
+	return BlockChange{
+		Action:     BlockAdd,
+		BookmarkID: bookmark.BookmarkID,
+		Preview:    bookmarkPreview(bookmark),
+		blocks:     s.renderer.Render(bookmark),
+		hash:       utils.HashBookmark(bookmark),
+	}
+}
+
+// syncedBookmarks returns the bookmarks rendering any block, markups without text have none
+func syncedBookmarks(bookmarks []kobo.Bookmark) []kobo.Bookmark {
+	var synced []kobo.Bookmark
+	for _, bookmark := range bookmarks {
+		if bookmark.Text != "" || bookmark.Annotation != "" || bookmark.IsDogEar() {
+			synced = append(synced, bookmark)
+		}
+	}
+	return synced
+}
+
+// sortBookmarks returns a copy of the bookmarks of a book in the sort order
+func (s *NotionService) sortBookmarks(bookmarks []kobo.Bookmark) []kobo.Bookmark {
+	sorted := slices.Clone(bookmarks)
+	kobo.SortBookmarks(sorted, s.sortOrder)
+	return sorted
+}
+
+// byPosition returns a copy of the bookmarks of a book in reading order
+func byPosition(bookmarks []kobo.Bookmark) []kobo.Bookmark {
+	sorted := slices.Clone(bookmarks)
+	kobo.SortByPosition(sorted)
+	return sorted
+}
+
+// applyBookPage applies the planned changes of an existing page
+func (s *NotionService) applyBookPage(change PageChange) error {
+	pageID := notionapi.PageID(change.PageID)
+
+	if change.RenameFrom != "" {
+		logger.Logger.Printf("Renaming book page %s to %s\n", change.RenameFrom, change.Book)
+	}
+
+	if change.PropertiesChanged {
+		if err := s.updateBookPageProperties(pageID, change.book, change.bookmarks); err != nil {
+			logger.Logger.Printf("Warning: could not update properties of page for book %s: %v\n", change.Book, err)
+		} else {
+			s.store.SetPageHash(change.PageID, change.propertiesHash)
+		}
+	} else if change.propertiesHash != "" {
+		s.store.SetPageHash(change.PageID, change.propertiesHash)
+	}
+
+	// Adopted blocks replace whatever the store knew about the page
+	if change.adopted != nil {
+		for bookmarkID := range s.store.PageEntries(change.PageID) {
+			s.store.Delete(bookmarkID)
+		}
+		for bookmarkID, entry := range change.adopted {
+			s.store.Set(bookmarkID, entry)
+		}
+		for chapterID := range s.store.PageChapters(change.PageID) {
+			s.store.DeleteChapter(change.PageID, chapterID)
+		}
+		for chapterID, blockID := range change.adoptedChapters {
+			s.store.SetChapter(change.PageID, chapterID, blockID)
+		}
+	}
+
+	// Blocks are updated in place first, then new blocks inserted, and replaced or removed
+	// blocks deleted last as new blocks may be inserted after them
+	updatedBookmarks := 0
+	var anchors []string
+	inserts := make(map[string][]BlockChange)
+	var deletes []BlockChange
+	var marks []BlockChange
+
+	for _, blockChange := range change.Blocks {
+		switch blockChange.Action {
+		case BlockUpdate:
+			kept := min(len(blockChange.BlockIDs), len(blockChange.blocks))
+			if !s.updateBlocksInPlace(blockChange.BlockIDs[:kept], blockChange.blocks[:kept]) {
+				logger.Logger.Printf("Warning: could not update bookmark %s, it will be retried on the next run\n", blockChange.BookmarkID)
+				continue
+			}
+			updatedBookmarks++
+
+			if len(blockChange.BlockIDs) > kept {
+				deletes = append(deletes, blockChange)
+			}
+
+			if len(blockChange.blocks) == kept {
+				s.store.Set(blockChange.BookmarkID, state.Entry{
+					PageID:   change.PageID,
+					BlockIDs: blockChange.BlockIDs[:kept],
+					Hash:     blockChange.hash,
+					Style:    storedStyle(s.renderer.Style()),
+					SyncedAt: time.Now(),
+				})
+				continue
+			}
+
+			// The rest of the bookmark is inserted after its last updated block
+			rest := blockChange
+			rest.BlockIDs = blockChange.BlockIDs[:kept]
+			rest.blocks = blockChange.blocks[kept:]
+			if _, exists := inserts[rest.After]; !exists {
+				anchors = append(anchors, rest.After)
+			}
+			inserts[rest.After] = append(inserts[rest.After], rest)
+
+		case BlockAdd, BlockReplace:
+			if _, exists := inserts[blockChange.After]; !exists {
+				anchors = append(anchors, blockChange.After)
+			}
+			inserts[blockChange.After] = append(inserts[blockChange.After], blockChange)
+			if blockChange.Action == BlockReplace {
+				deletes = append(deletes, blockChange)
+			}
+
+		case BlockDelete:
+			deletes = append(deletes, blockChange)
+
+		case BlockMark:
+			marks = append(marks, blockChange)
+		}
+	}
+
+	if updatedBookmarks > 0 {
+		logger.Logger.Printf("Page updated %d edited bookmarks in place\n", updatedBookmarks)
+	}
+
+	// Insert new blocks, each run after the synced block preceding it
+	for _, after := range anchors {
+		var blocks []notionapi.Block
+		var pending []pendingBookmark
+		for _, blockChange := range inserts[after] {
+			blocks = append(blocks, blockChange.blocks...)
+			pendingChange := pendingBookmark{
+				bookmarkID: blockChange.BookmarkID,
+				chapterID:  blockChange.ChapterID,
+				hash:       blockChange.hash,
+				blockCount: len(blockChange.blocks),
+			}
+			if blockChange.Action == BlockUpdate {
+				pendingChange.keptIDs = blockChange.BlockIDs
+			}
+			pending = append(pending, pendingChange)
+		}
 
+		created, err := s.appendBlocks(notionapi.BlockID(pageID), notionapi.BlockID(after), blocks)
+
+		// Record even partial appends, blocks without known IDs are adopted on the next run
+		s.recordAppendedBlocks(pageID, pending, created)
 		if err != nil {
 			return err
 		}
 
-		logger.Logger.Printf("Page updated with %d new blocks\n", len(allBlocks))
+		logger.Logger.Printf("Page updated with %d new blocks\n", len(blocks))
+	}
+
+	for _, blockChange := range deletes {
+		switch {
+		case blockChange.Action == BlockUpdate:
+			s.deleteBlocks(toBlockIDs(blockChange.BlockIDs[len(blockChange.blocks):]))
+		case blockChange.Action == BlockReplace:
+			s.deleteBlocks(toBlockIDs(blockChange.BlockIDs))
+		case blockChange.ChapterID != "":
+			s.deleteBlocks(toBlockIDs(blockChange.BlockIDs))
+			s.store.DeleteChapter(change.PageID, blockChange.ChapterID)
+		case blockChange.BookmarkID == "":
+			if deleted := s.deleteBlocks(toBlockIDs(blockChange.BlockIDs)); deleted > 0 {
+				logger.Logger.Printf("Page deleted blocks: %d\n", deleted)
+			}
+		default:
+			logger.Debugf("Bookmark %s no longer exists, deleting its blocks", blockChange.BookmarkID)
+			s.deleteBlocks(toBlockIDs(blockChange.BlockIDs))
+			s.store.Delete(blockChange.BookmarkID)
+		}
+	}
+
+	for _, blockChange := range marks {
+		logger.Debugf("Bookmark %s no longer exists, marking its blocks as removed", blockChange.BookmarkID)
+		if !s.strikeBlocks(toBlockIDs(blockChange.BlockIDs)) {
+			continue
+		}
+		if entry, ok := s.store.Get(blockChange.BookmarkID); ok {
+			entry.Removed = true
+			s.store.Set(blockChange.BookmarkID, entry)
+		}
 	}
 
 	return nil
 }
 
-// createBookPageWithBookmarks creates a new page with multiple bookmarks
-func (s *NotionService) createBookPageWithBookmarks(databaseID string, bookmarks []kobo.Bookmark) error {
-	if len(bookmarks) == 0 {
-		return errors.New("no bookmarks provided")
+// sortedKeys returns the keys of a map in order, keeping plans and logs stable between runs
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
 	}
+	sort.Strings(keys)
+	return keys
+}
 
-	// Use the first bookmark for page properties
-	firstBookmark := bookmarks[0]
-	bookName := utils.GetBookNameFromVolumeID(firstBookmark.VolumeID)
+// createBookPageWithBookmarks creates a new page with the bookmarks of a book, books mirrored
+// from the library may have none
+func (s *NotionService) createBookPageWithBookmarks(databaseID string, book kobo.Book, bookmarks []kobo.Bookmark) error {
+	values := bookFieldValues(book, bookmarks, s.colorNames)
 
-	parsedDate, err := utils.ParseKoboBookmarkDate(firstBookmark.DateCreated)
-	if err != nil {
-		return err
+	// The creation date comes from the first bookmark
+	if len(bookmarks) > 0 {
+		parsedDate, err := utils.ParseKoboBookmarkDate(bookmarks[0].DateCreated)
+		if err != nil {
+			return err
+		}
+		values[config.FieldCreated] = parsedDate
 	}
 
-	createdAt := notionapi.Date(parsedDate)
-
-	// Create blocks for all bookmarks
+	// Create blocks for all bookmarks in reading order, under the heading of their chapter
 	var allBlocks []notionapi.Block
-
-	for _, bookmark := range bookmarks {
-		allBlocks = append(allBlocks, s.createBookmarkTextBlocks(bookmark)...)
-		allBlocks = append(allBlocks, s.createBookmarkAnnotationBlocks(bookmark)...)
+	var pending []pendingBookmark
+
+	for _, blockChange := range s.addBlockChanges(s.sortBookmarks(bookmarks)) {
+		allBlocks = append(allBlocks, blockChange.blocks...)
+		pending = append(pending, pendingBookmark{
+			bookmarkID: blockChange.BookmarkID,
+			chapterID:  blockChange.ChapterID,
+			hash:       blockChange.hash,
+			blockCount: len(blockChange.blocks),
+		})
 	}
 
+	properties := s.buildProperties(values, PlanModeGrouped)
+
+	// A page is created with as many blocks as a request accepts, the rest is appended after
+	initialBlocks := allBlocks[:min(len(allBlocks), maxBlocksPerRequest)]
+	remainingBlocks := allBlocks[len(initialBlocks):]
+
 	payload := &notionapi.PageCreateRequest{
 		Parent: notionapi.Parent{
 			DatabaseID: notionapi.DatabaseID(databaseID),
 		},
-		Properties: notionapi.Properties{
-			PropBookTitle: notionapi.TitleProperty{
-				Title: []notionapi.RichText{
-					{
-						Text: &notionapi.Text{
-							Content: bookName,
-						},
-					},
-				},
-			},
-			PropDateCreated: notionapi.DateProperty{
-				Date: &notionapi.DateObject{
-					Start: &createdAt,
-				},
-			},
-			PropBookName: notionapi.RichTextProperty{
-				RichText: []notionapi.RichText{
-					{
-						Type: notionapi.ObjectTypeText,
-						Text: &notionapi.Text{
-							Content: bookName,
-						},
-					},
-				},
-			},
-		},
-		Children: allBlocks,
+		Properties: properties,
+		Children:   initialBlocks,
 	}
 
-	_, err = s.pageClient.Create(s.contextFunc(), payload)
+	page, err := s.pageClient.Create(s.contextFunc(), payload)
 	if err != nil {
 		return err
 	}
 
+	s.store.SetBookPage(book.VolumeID, string(page.ID))
+	s.store.SetPageHash(string(page.ID), propertiesHash(s.bookPageProperties(book, bookmarks)))
+
+	if len(remainingBlocks) > 0 {
+		_, err = s.appendBlocks(notionapi.BlockID(page.ID), "", remainingBlocks)
+		if err != nil {
+			s.recordAppendedBlocks(notionapi.PageID(page.ID), pending, nil)
+			return err
+		}
+	}
+
+	// The created blocks are not returned, reading them back lets bookmarks removed before
+	// the next update be deleted. Entries are stored without IDs and adopted if it fails.
+	var created []notionapi.Block
+	if len(pending) > 0 {
+		created, err = s.getAllBlocksFromPage(notionapi.PageID(page.ID))
+		if err != nil {
+			logger.Logger.Printf("Warning: could not read the blocks of the new page for book %s: %v\n", utils.GetBookTitle(book), err)
+		}
+	}
+	s.recordAppendedBlocks(notionapi.PageID(page.ID), pending, created)
+
 	logger.Logger.Printf("Book page created successfully with %d bookmarks!\n", len(bookmarks))
 	return nil
 }
+
+// updateBookPageProperties refreshes the properties of an existing book page
+func (s *NotionService) updateBookPageProperties(pageID notionapi.PageID, book kobo.Book, bookmarks []kobo.Bookmark) error {
+	_, err := s.pageClient.Update(s.contextFunc(), pageID, &notionapi.PageUpdateRequest{
+		Properties: s.bookPageProperties(book, bookmarks),
+	})
+	return err
+}
+
+// bookPageProperties builds the properties of a book page kept up to date on every sync,
+// the creation date is only written when the page is created
+func (s *NotionService) bookPageProperties(book kobo.Book, bookmarks []kobo.Bookmark) notionapi.Properties {
+	return s.buildProperties(bookFieldValues(book, bookmarks, s.colorNames), PlanModeGrouped)
+}
+
+// pagePropertiesChanged reports whether the properties of a book page differ from the ones
+// last written. Pages synced before their properties were tracked are assumed up to date,
+// unless fields changing with every highlight or reading session are mapped.
+func (s *NotionService) pagePropertiesChanged(pageID notionapi.PageID, hash string) bool {
+	storedHash := s.store.PageHash(string(pageID))
+	return hash != storedHash && (storedHash != "" || s.hasAggregateFields())
+}
+
+// hasAggregateFields reports whether fields computed from all highlights of a book are mapped
+func (s *NotionService) hasAggregateFields() bool {
+	for _, field := range bookAggregateFields {
+		if _, ok := s.properties[field]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// richTextProperty builds a rich text property holding a text value, split to fit
+// the 2000 characters Notion accepts per text object
+func richTextProperty(content string) notionapi.RichTextProperty {
+	const propertyTextSplit = 2000
+
+	chunks := utils.SplitText(content, propertyTextSplit)
+
+	// Properties hold at most maxRichTextPerBlock text objects, longer content is truncated
+	if len(chunks) > maxRichTextPerBlock {
+		logger.Logger.Printf("Warning: property text truncated to %d characters\n", maxRichTextPerBlock*propertyTextSplit)
+		chunks = chunks[:maxRichTextPerBlock]
+	}
+
+	richText := []notionapi.RichText{}
+	for _, chunk := range chunks {
+		richText = append(richText, notionapi.RichText{
+			Type: notionapi.ObjectTypeText,
+			Text: &notionapi.Text{
+				Content: chunk,
+			},
+		})
+	}
+
+	return notionapi.RichTextProperty{
+		RichText: richText,
+	}
+}
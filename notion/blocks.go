@@ -1,7 +1,7 @@
 package notion
 
 import (
-	"kobo-to-notion/kobo"
+	"kobo-to-notion/config"
 	"kobo-to-notion/utils"
 
 	"github.com/jomei/notionapi"
@@ -9,6 +9,11 @@ import (
 
 // getAllBlocksFromPage retrieves all blocks from a page
 func (s *NotionService) getAllBlocksFromPage(pageID notionapi.PageID) ([]notionapi.Block, error) {
+	return s.getChildBlocks(notionapi.BlockID(pageID))
+}
+
+// getChildBlocks retrieves all children of a page or block
+func (s *NotionService) getChildBlocks(parentID notionapi.BlockID) ([]notionapi.Block, error) {
 	var blocks []notionapi.Block
 	var startCursor notionapi.Cursor
 
@@ -18,7 +23,7 @@ func (s *NotionService) getAllBlocksFromPage(pageID notionapi.PageID) ([]notiona
 			pagination.StartCursor = startCursor
 		}
 
-		resp, err := s.blockClient.GetChildren(s.contextFunc(), notionapi.BlockID(pageID), pagination)
+		resp, err := s.blockClient.GetChildren(s.contextFunc(), parentID, pagination)
 		if err != nil {
 			return nil, err
 		}
@@ -36,133 +41,149 @@ func (s *NotionService) getAllBlocksFromPage(pageID notionapi.PageID) ([]notiona
 	return blocks, nil
 }
 
-func getColorsMap() map[string]notionapi.Color {
-	return map[string]notionapi.Color{
-		"0": notionapi.ColorOrange,
-		"1": notionapi.ColorPurple,
-		"2": notionapi.ColorBlue,
-		"3": notionapi.ColorGreen,
-		"4": notionapi.ColorRed,
-	}
+// isSyncedBlock reports whether a block was written by the sync. Synced blocks are
+// blocks whose first rich text is the bold label added by the bookmark renderers,
+// every other block on a page belongs to the user and must be left untouched.
+func isSyncedBlock(block notionapi.Block) bool {
+	label := syncedBlockLabel(block)
+	return label == PropHighlightedText || label == PropAnnotation || label == locationLabel
 }
 
-// createBookmarkBlocks creates a set of blocks for a bookmark
-func (s *NotionService) createBookmarkTextBlocks(bookmark kobo.Bookmark) []notionapi.Block {
-	colorsMap := getColorsMap();
-
-	if bookmark.Text == "" {
-		return []notionapi.Block{}
+// syncedBlockLabel returns the bold label at the start of a rendered block, if any
+func syncedBlockLabel(block notionapi.Block) string {
+	richText, _ := blockContent(block)
+	if len(richText) == 0 {
+		return ""
 	}
 
-	// Split text into chunks of 2000 characters
-	const bookMarkTextSplit = 2000
-	textChunks := utils.SplitText(bookmark.Text, bookMarkTextSplit)
-
-	// Create notionapi.RichText blocks for each chunk
-	paragraphBlocks := []notionapi.RichText{}
+	label := richText[0]
+	if label.Annotations == nil || !label.Annotations.Bold {
+		return ""
+	}
 
-	if len(textChunks) > 0 {
-		paragraphBlocks = append(paragraphBlocks, notionapi.RichText{
-			Type: notionapi.ObjectTypeText,
-			Text: &notionapi.Text{
-				Content: PropHighlightedText,
-			},
-			Annotations: &notionapi.Annotations{
-				Bold:  true,
-				Color: colorsMap[bookmark.Color],
-			},
-		}, notionapi.RichText{
-			Type: notionapi.ObjectTypeText,
-			Text: &notionapi.Text{
-				Content: `
-`,
-			},
-		})
+	if label.PlainText == "" && label.Text != nil {
+		return label.Text.Content
+	}
+	return label.PlainText
+}
 
-		for _, chunk := range textChunks {
-			paragraphBlocks = append(paragraphBlocks, notionapi.RichText{
-				Type: notionapi.ObjectTypeText,
-				Text: &notionapi.Text{
-					Content: chunk,
-				},
-			})
+// filterSyncedBlocks returns only the blocks written by the sync
+func filterSyncedBlocks(blocks []notionapi.Block) []notionapi.Block {
+	var synced []notionapi.Block
+	for _, block := range blocks {
+		if isSyncedBlock(block) {
+			synced = append(synced, block)
 		}
 	}
+	return synced
+}
 
-	blocks := []notionapi.Block{}
+// highlightColors returns the colour of the labels of a bookmark and the background of
+// its highlighted text, both empty for unknown colours
+func highlightColors(index string) (notionapi.Color, notionapi.Color) {
+	color, ok := config.HighlightColorByIndex(index)
+	if !ok {
+		return "", ""
+	}
+	return notionapi.Color(color.Name), notionapi.Color(color.Name + "_background")
+}
 
-	if len(paragraphBlocks) > 0 {
-		blocks = append(blocks, &notionapi.QuoteBlock{
-			BasicBlock: notionapi.BasicBlock{
-				Object: notionapi.ObjectTypeBlock,
-				Type:   notionapi.BlockTypeQuote,
-			},
-			Quote: notionapi.Quote{
-				RichText: paragraphBlocks,
-			},
-		})
+// blockContent returns the rich text and children of the block types bookmarks are rendered with
+func blockContent(block notionapi.Block) ([]notionapi.RichText, []notionapi.Block) {
+	switch b := block.(type) {
+	case *notionapi.QuoteBlock:
+		return b.Quote.RichText, b.Quote.Children
+	case notionapi.QuoteBlock:
+		return b.Quote.RichText, b.Quote.Children
+	case *notionapi.CalloutBlock:
+		return b.Callout.RichText, b.Callout.Children
+	case *notionapi.ToggleBlock:
+		return b.Toggle.RichText, b.Toggle.Children
+	case *notionapi.BulletedListItemBlock:
+		return b.BulletedListItem.RichText, b.BulletedListItem.Children
+	default:
+		return nil, nil
 	}
+}
 
-	return blocks
+// blockChildren returns the children a rendered block is created with
+func blockChildren(block notionapi.Block) []notionapi.Block {
+	_, children := blockContent(block)
+	return children
 }
 
-func (s *NotionService) createBookmarkAnnotationBlocks(bookmark kobo.Bookmark) []notionapi.Block {
-	colorsMap := getColorsMap();
-	
-	if bookmark.Annotation == "" {
-		return []notionapi.Block{}
+// blockUpdateRequest converts a rendered block into the request updating an existing block with its content
+func blockUpdateRequest(block notionapi.Block) (*notionapi.BlockUpdateRequest, bool) {
+	switch b := block.(type) {
+	case *notionapi.QuoteBlock:
+		return &notionapi.BlockUpdateRequest{Quote: &notionapi.Quote{RichText: b.Quote.RichText}}, true
+	case notionapi.QuoteBlock:
+		return &notionapi.BlockUpdateRequest{Quote: &notionapi.Quote{RichText: b.Quote.RichText}}, true
+	case *notionapi.CalloutBlock:
+		return &notionapi.BlockUpdateRequest{Callout: &notionapi.Callout{RichText: b.Callout.RichText, Icon: b.Callout.Icon}}, true
+	case *notionapi.ToggleBlock:
+		return &notionapi.BlockUpdateRequest{Toggle: &notionapi.Toggle{RichText: b.Toggle.RichText}}, true
+	case *notionapi.BulletedListItemBlock:
+		return &notionapi.BlockUpdateRequest{BulletedListItem: &notionapi.ListItem{RichText: b.BulletedListItem.RichText}}, true
+	default:
+		return nil, false
 	}
+}
 
-	// Split text into chunks of 2000 characters
-	const bookMarkTextSplit = 2000
-	annotationChunks := utils.SplitText(bookmark.Annotation, bookMarkTextSplit)
-
-	blocks := []notionapi.Block{}
+// createChapterHeading creates the heading written above the highlights of a chapter
+func createChapterHeading(title string) notionapi.Block {
+	const headingTextSplit = 2000
+
+	return &notionapi.Heading2Block{
+		BasicBlock: notionapi.BasicBlock{
+			Object: notionapi.ObjectTypeBlock,
+			Type:   notionapi.BlockTypeHeading2,
+		},
+		Heading2: notionapi.Heading{
+			RichText: []notionapi.RichText{
+				{
+					Type: notionapi.ObjectTypeText,
+					Text: &notionapi.Text{
+						Content: utils.SplitText(title, headingTextSplit)[0],
+					},
+				},
+			},
+		},
+	}
+}
 
-	// Create notionapi.RichText blocks for each chunk
-	annotationBlocks := []notionapi.RichText{}
+// appendBlocks appends blocks to a page or block in batches Notion accepts, preserving their order.
+// Blocks are inserted after the given block, or at the end when it is empty. The blocks created
+// before a failing batch are returned along with the error.
+func (s *NotionService) appendBlocks(parentID notionapi.BlockID, after notionapi.BlockID, blocks []notionapi.Block) ([]notionapi.Block, error) {
+	var created []notionapi.Block
 
-	if len(annotationChunks) > 0 {
-		annotationBlocks = append(annotationBlocks, notionapi.RichText{
-			Type: notionapi.ObjectTypeText,
-			Text: &notionapi.Text{
-				Content: PropAnnotation,
-			},
-			Annotations: &notionapi.Annotations{
-				Bold:  true,
-				Color: colorsMap[bookmark.Color],
-			},
-		}, notionapi.RichText{
-			Type: notionapi.ObjectTypeText,
-			Text: &notionapi.Text{
-				Content: `
-`,
-			},
+	for _, batch := range chunkBlocks(blocks, maxBlocksPerRequest) {
+		resp, err := s.blockClient.AppendChildren(s.contextFunc(), parentID, &notionapi.AppendBlockChildrenRequest{
+			After:    after,
+			Children: batch,
 		})
+		if err != nil {
+			return created, err
+		}
 
-		for _, chunk := range annotationChunks {
-			annotationBlocks = append(annotationBlocks, notionapi.RichText{
-				Type: notionapi.ObjectTypeText,
-				Text: &notionapi.Text{
-					Content: chunk,
-				},
-			})
+		created = append(created, resp.Results...)
+
+		// The next batch goes after the last block of this one
+		if after != "" && len(resp.Results) == len(batch) {
+			after = resp.Results[len(resp.Results)-1].GetID()
 		}
 	}
 
-	if len(annotationBlocks) > 0 {
-		blocks = append(blocks,
-			&notionapi.QuoteBlock{
-				BasicBlock: notionapi.BasicBlock{
-					Object: notionapi.ObjectTypeBlock,
-					Type:   notionapi.BlockTypeQuote,
-				},
-				Quote: notionapi.Quote{
-					RichText: annotationBlocks,
-				},
-			},
-		)
-	}
+	return created, nil
+}
 
-	return blocks
+// chunkBlocks splits blocks into consecutive batches of at most size blocks
+func chunkBlocks(blocks []notionapi.Block, size int) [][]notionapi.Block {
+	var batches [][]notionapi.Block
+	for start := 0; start < len(blocks); start += size {
+		end := min(start+size, len(blocks))
+		batches = append(batches, blocks[start:end])
+	}
+	return batches
 }
@@ -2,13 +2,17 @@ package notion
 
 import (
 	"context"
+	"kobo-to-notion/config"
+	"kobo-to-notion/kobo"
+	"kobo-to-notion/state"
 	"kobo-to-notion/utils"
 	"net/http"
 
 	"github.com/jomei/notionapi"
 )
 
-// Constants for property names
+// Constants for property names. These are the default names of the database properties,
+// the highlight and annotation names also label the blocks of book pages.
 const (
 	PropBookTitle       = "Book Title"
 	PropHighlightedText = "Highlighted Text"
@@ -17,13 +21,25 @@ const (
 	PropDateCreated     = "Date Created"
 	PropBookmarkID      = "Bookmark ID"
 	PropBookName        = "Book Name"
+	PropAuthor          = "Author"
+	PropISBN            = "ISBN"
+	PropPublisher       = "Publisher"
 
 	ErrNotionClientNotInitialized = "notion client not initialized"
 )
 
+// Limits of the Notion API, see https://developers.notion.com/reference/request-limits
+const (
+	maxBlocksPerRequest = 100
+	maxRichTextPerBlock = 100
+)
+
 // Interfaces for the Notion API clients
 type NotionDatabaseClient interface {
 	Query(ctx context.Context, id notionapi.DatabaseID, req *notionapi.DatabaseQueryRequest) (*notionapi.DatabaseQueryResponse, error)
+	Get(ctx context.Context, id notionapi.DatabaseID) (*notionapi.Database, error)
+	Create(ctx context.Context, req *notionapi.DatabaseCreateRequest) (*notionapi.Database, error)
+	Update(ctx context.Context, id notionapi.DatabaseID, req *notionapi.DatabaseUpdateRequest) (*notionapi.Database, error)
 }
 
 type NotionPageClient interface {
@@ -46,23 +62,51 @@ type NotionService struct {
 	pageClient  NotionPageClient
 	blockClient notionapi.BlockService // Using the actual BlockService from the API
 	contextFunc func() context.Context
+	store       *state.Store
+	fullSync    bool
+	transport   *RetryTransport
+	properties  map[string]config.PropertyMapping
+	sortOrder   string
+	renderer    BookmarkRenderer
+	colorNames  map[string]string
+	library     []kobo.Book
+	mirror      kobo.BookFilter // Selects the library books given a page without highlights
+	deletion    deletionPolicy
+}
+
+// newRateLimitedClient creates a Notion client whose requests go through a RetryTransport.
+// The client's own 429 handling is disabled, the transport already retries them.
+func newRateLimitedClient(token notionapi.Token, httpClient *http.Client) (*notionapi.Client, *RetryTransport) {
+	transport := NewRetryTransport(httpClient.Transport)
+
+	retryClient := *httpClient
+	retryClient.Transport = transport
+
+	return notionapi.NewClient(token, notionapi.WithHTTPClient(&retryClient), notionapi.WithRetry(1)), transport
 }
 
 // NewNotionService creates a new NotionService
 func NewNotionService(notionToken string) *NotionService {
-	client := notionapi.NewClient(notionapi.Token(notionToken))
+	client, transport := newRateLimitedClient(notionapi.Token(notionToken), &http.Client{})
 	return &NotionService{
 		client:      client,
 		dbClient:    client.Database, // Use client's DB interface
 		pageClient:  client.Page,     // Use client's Page interface
 		blockClient: client.Block,    // Use client's Block interface
 		contextFunc: context.Background,
+		store:       state.New(), // In-memory until a persistent store is set
+		transport:   transport,
+		properties:  config.DefaultProperties(),
+		sortOrder:   kobo.OrderPosition,
+		renderer:    defaultRenderer(),
+		colorNames:  config.DefaultColorNames(),
+		deletion:    defaultDeletionPolicy(),
 	}
 }
 
-// WithHTTPClient allows configuring the HTTP client
+// WithHTTPClient allows configuring the HTTP client, its transport is wrapped to respect the Notion rate limit
 func (s *NotionService) WithHTTPClient(httpClient *http.Client) *NotionService {
-	s.client = notionapi.NewClient(notionapi.Token(s.client.Token), notionapi.WithHTTPClient(httpClient))
+	s.client, s.transport = newRateLimitedClient(s.client.Token, httpClient)
 	s.dbClient = s.client.Database
 	s.pageClient = s.client.Page
 	s.blockClient = s.client.Block
@@ -93,6 +137,63 @@ func (s *NotionService) WithContextFunc(ctxFunc func() context.Context) *NotionS
 	return s
 }
 
+// WithStateStore allows setting the store that remembers synced blocks between runs
+func (s *NotionService) WithStateStore(store *state.Store) *NotionService {
+	s.store = store
+	return s
+}
+
+// WithFullSync makes the sync revisit every book and re-read its page, ignoring the watermark
+func (s *NotionService) WithFullSync(fullSync bool) *NotionService {
+	s.fullSync = fullSync
+	return s
+}
+
+// WithProperties sets the database properties the fields of a page are written to
+func (s *NotionService) WithProperties(properties map[string]config.PropertyMapping) *NotionService {
+	s.properties = properties
+	return s
+}
+
+// WithSortOrder sets the order in which the highlights of a book are written, see kobo.SortBookmarks
+func (s *NotionService) WithSortOrder(order string) *NotionService {
+	s.sortOrder = order
+	return s
+}
+
+// WithRenderer sets how bookmarks are rendered on book pages
+func (s *NotionService) WithRenderer(renderer BookmarkRenderer) *NotionService {
+	s.renderer = renderer
+	return s
+}
+
+// WithColorNames sets the category written for each Kobo highlight colour, see config.ParseColorNames
+func (s *NotionService) WithColorNames(colorNames map[string]string) *NotionService {
+	s.colorNames = colorNames
+	return s
+}
+
+// WithLibrary sets the books of the Kobo library. Books matching the filter get a page even
+// without highlights, and the pages of library books are kept when their last highlight is removed.
+func (s *NotionService) WithLibrary(books []kobo.Book, filter kobo.BookFilter) *NotionService {
+	s.library = books
+	s.mirror = filter
+	return s
+}
+
+// WithDeletePolicy sets what happens to the pages and highlights of books removed from the Kobo,
+// see config.DeletePolicyArchive. Pages are only removed once their book has been missing for
+// afterMissing syncs in a row, and plans removing more than maxPercent of the pages fail.
+func (s *NotionService) WithDeletePolicy(policy string, afterMissing int, maxPercent int) *NotionService {
+	s.deletion = deletionPolicy{policy: policy, afterMissing: afterMissing, maxPercent: maxPercent}
+	return s
+}
+
+// RequestSummary describes the Notion requests sent so far, including failed ones
+func (s *NotionService) RequestSummary() string {
+	return s.transport.Summary()
+}
+
 // InitializeWithCert initializes the service with a certificate file
 func (s *NotionService) InitializeWithCert(certPath string) error {
 	// Configure a secure HTTP client with embedded certificates
@@ -7,12 +7,22 @@ This package is divided into several files:
 - query.go: Notion database queries
 - blocks.go: Content block manipulation
 - add_grouped.go: Add bookmarks grouped by books
+- add_flat.go: Add every bookmark as its own database row
+- tracking.go: Mapping of bookmarks to the blocks synced for them
+- plan.go: Sync plans, computed before anything is written to Notion
+- schema.go: Validation and provisioning of the database properties
+- properties.go: Page properties built from the configured property mapping
+- transport.go: Rate limiting and retries of the requests sent to Notion
+- render.go: Blocks written for bookmarks in each block style
+- removal.go: Deletion policy for books and bookmarks removed from the Kobo
 */
 
 // This file serves as an entry point and re-exports the package's functionality
 import (
 	"errors"
+	"kobo-to-notion/config"
 	"kobo-to-notion/kobo"
+	"kobo-to-notion/state"
 
 	"github.com/jomei/notionapi"
 )
@@ -41,6 +51,147 @@ func AddBookmarksToNotion(databaseID string, bookmarks []kobo.Bookmark) error {
 	return defaultService.AddBookmarks(databaseID, bookmarks)
 }
 
+// AddBookmarksFlatToNotion adds every bookmark as its own row using the global client
+func AddBookmarksFlatToNotion(databaseID string, bookmarks []kobo.Bookmark) error {
+	if defaultService == nil {
+		return errors.New(ErrNotionClientNotInitialized)
+	}
+	return defaultService.AddBookmarksFlat(databaseID, bookmarks)
+}
+
+// PlanBookmarksInNotion computes the changes a grouped sync would make using the global client
+func PlanBookmarksInNotion(databaseID string, bookmarks []kobo.Bookmark) (*Plan, error) {
+	if defaultService == nil {
+		return nil, errors.New(ErrNotionClientNotInitialized)
+	}
+	return defaultService.PlanBookmarks(databaseID, bookmarks)
+}
+
+// PlanBookmarksFlatInNotion computes the changes a flat sync would make using the global client
+func PlanBookmarksFlatInNotion(databaseID string, bookmarks []kobo.Bookmark) (*Plan, error) {
+	if defaultService == nil {
+		return nil, errors.New(ErrNotionClientNotInitialized)
+	}
+	return defaultService.PlanBookmarksFlat(databaseID, bookmarks)
+}
+
+// CheckNotionDatabase verifies the database can be read using the global client
+func CheckNotionDatabase(databaseID string) (string, error) {
+	if defaultService == nil {
+		return "", errors.New(ErrNotionClientNotInitialized)
+	}
+	return defaultService.CheckDatabase(databaseID)
+}
+
+// ValidateNotionSchema reports the database properties not matching a sync mode using the global client
+func ValidateNotionSchema(databaseID string, mode string) ([]SchemaIssue, error) {
+	if defaultService == nil {
+		return nil, errors.New(ErrNotionClientNotInitialized)
+	}
+	return defaultService.ValidateSchema(databaseID, mode)
+}
+
+// DropMissingOptionalProperties stops writing the optional properties the database lacks using the global client
+func DropMissingOptionalProperties(databaseID string) error {
+	if defaultService == nil {
+		return errors.New(ErrNotionClientNotInitialized)
+	}
+	return defaultService.DropMissingOptionalProperties(databaseID)
+}
+
+// FixNotionSchema adds the missing database properties of a sync mode using the global client
+func FixNotionSchema(databaseID string, mode string) ([]SchemaIssue, error) {
+	if defaultService == nil {
+		return nil, errors.New(ErrNotionClientNotInitialized)
+	}
+	return defaultService.FixSchema(databaseID, mode)
+}
+
+// CreateNotionDatabase creates a database for a sync mode under a page using the global client
+func CreateNotionDatabase(parentPageID string, title string, mode string) (string, error) {
+	if defaultService == nil {
+		return "", errors.New(ErrNotionClientNotInitialized)
+	}
+	return defaultService.CreateDatabase(parentPageID, title, mode)
+}
+
+// SetStateStore sets the sync state store of the global client
+func SetStateStore(store *state.Store) error {
+	if defaultService == nil {
+		return errors.New(ErrNotionClientNotInitialized)
+	}
+	defaultService.WithStateStore(store)
+	return nil
+}
+
+// SetFullSync enables or disables full syncs on the global client
+func SetFullSync(fullSync bool) error {
+	if defaultService == nil {
+		return errors.New(ErrNotionClientNotInitialized)
+	}
+	defaultService.WithFullSync(fullSync)
+	return nil
+}
+
+// SetProperties sets the database properties the global client writes to
+func SetProperties(properties map[string]config.PropertyMapping) error {
+	if defaultService == nil {
+		return errors.New(ErrNotionClientNotInitialized)
+	}
+	defaultService.WithProperties(properties)
+	return nil
+}
+
+// SetSortOrder sets the order in which the global client writes the highlights of a book
+func SetSortOrder(order string) error {
+	if defaultService == nil {
+		return errors.New(ErrNotionClientNotInitialized)
+	}
+	defaultService.WithSortOrder(order)
+	return nil
+}
+
+// SetBlockStyle sets the style in which the global client renders bookmarks
+func SetBlockStyle(style string) error {
+	if defaultService == nil {
+		return errors.New(ErrNotionClientNotInitialized)
+	}
+
+	renderer, err := NewBookmarkRenderer(style)
+	if err != nil {
+		return err
+	}
+	defaultService.WithRenderer(renderer)
+	return nil
+}
+
+// SetColorNames sets the category the global client writes for each Kobo highlight colour
+func SetColorNames(colorNames map[string]string) error {
+	if defaultService == nil {
+		return errors.New(ErrNotionClientNotInitialized)
+	}
+	defaultService.WithColorNames(colorNames)
+	return nil
+}
+
+// SetLibrary sets the Kobo library mirrored by the global client
+func SetLibrary(books []kobo.Book, filter kobo.BookFilter) error {
+	if defaultService == nil {
+		return errors.New(ErrNotionClientNotInitialized)
+	}
+	defaultService.WithLibrary(books, filter)
+	return nil
+}
+
+// SetDeletePolicy sets what the global client does with books removed from the Kobo
+func SetDeletePolicy(policy string, afterMissing int, maxPercent int) error {
+	if defaultService == nil {
+		return errors.New(ErrNotionClientNotInitialized)
+	}
+	defaultService.WithDeletePolicy(policy, afterMissing, maxPercent)
+	return nil
+}
+
 func (s *NotionService) ArchivePage(databaseID string, pageID notionapi.PageID) (error) {
 	_, err := s.pageClient.Update(s.contextFunc(), pageID, &notionapi.PageUpdateRequest{
 		Archived: true, 
@@ -2,12 +2,19 @@ package notion_test
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"kobo-to-notion/config"
 	"kobo-to-notion/kobo"
 	"kobo-to-notion/logger"
 	"kobo-to-notion/notion"
+	"kobo-to-notion/state"
+	"kobo-to-notion/utils"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jomei/notionapi"
 	"github.com/stretchr/testify/assert"
@@ -35,6 +42,21 @@ func (m *MockDatabaseClient) Query(ctx context.Context, id notionapi.DatabaseID,
 	return args.Get(0).(*notionapi.DatabaseQueryResponse), args.Error(1)
 }
 
+func (m *MockDatabaseClient) Get(ctx context.Context, id notionapi.DatabaseID) (*notionapi.Database, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(*notionapi.Database), args.Error(1)
+}
+
+func (m *MockDatabaseClient) Create(ctx context.Context, req *notionapi.DatabaseCreateRequest) (*notionapi.Database, error) {
+	args := m.Called(ctx, req)
+	return args.Get(0).(*notionapi.Database), args.Error(1)
+}
+
+func (m *MockDatabaseClient) Update(ctx context.Context, id notionapi.DatabaseID, req *notionapi.DatabaseUpdateRequest) (*notionapi.Database, error) {
+	args := m.Called(ctx, id, req)
+	return args.Get(0).(*notionapi.Database), args.Error(1)
+}
+
 // MockPageClient mocks the NotionPageClient interface
 type MockPageClient struct {
 	mock.Mock
@@ -85,6 +107,14 @@ func (m *MockBlockClient) Update(ctx context.Context, blockID notionapi.BlockID,
 	return args.Get(0).(notionapi.Block), args.Error(1)
 }
 
+// newCreatedPageBlockClient returns a block client for tests creating pages, whose blocks
+// are read back once created
+func newCreatedPageBlockClient() *MockBlockClient {
+	client := &MockBlockClient{}
+	client.On("GetChildren", mock.Anything, mock.Anything, mock.Anything).Return(&notionapi.GetChildrenResponse{}, nil)
+	return client
+}
+
 // Setup function to initialize logger for tests
 func setupLogger() {
 	// Create a temporary log file
@@ -298,7 +328,7 @@ func TestAddBookmarksGroup(t *testing.T) {
 	// Create mock clients
 	mockDBClient := new(MockDatabaseClient)
 	mockPageClient := new(MockPageClient)
-	mockBlockClient := &MockBlockClient{}
+	mockBlockClient := newCreatedPageBlockClient()
 
 	// Create a test service with our mock
 	service := notion.NewNotionService("test-token")
@@ -359,8 +389,12 @@ func TestAddBookmarksGroup(t *testing.T) {
 	assert.True(t, ok, "Book Title should be a TitleProperty")
 	assert.Contains(t, titleProp.Title[0].Text.Content, "test-volume-id")
 
-	// Should have multiple children blocks
-	assert.Greater(t, len(req.Children), 2, "Should have multiple blocks")
+	// Each bookmark is a single quote holding its annotation
+	assert.Len(t, req.Children, 2, "Should have one block per bookmark")
+	quote := req.Children[0].(*notionapi.QuoteBlock)
+	assert.Equal(t, PropHighlightedText, quote.Quote.RichText[0].Text.Content)
+	assert.Len(t, quote.Quote.Children, 1, "Annotation should be nested in the highlight")
+	assert.Equal(t, PropAnnotation, quote.Quote.Children[0].(*notionapi.QuoteBlock).Quote.RichText[0].Text.Content)
 }
 
 func TestAddBookmarksGroupExistingPage(t *testing.T) {
@@ -436,3 +470,2073 @@ func TestAddBookmarksGroupExistingPage(t *testing.T) {
 	mockBlockClient.AssertExpectations(t)
 	mockPageClient.AssertExpectations(t)
 }
+
+func TestAddBookmarksKeepsBooksSharingATitleApart(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	first := kobo.Bookmark{
+		BookmarkID:  "first",
+		VolumeID:    "file:///mnt/onboard/volume-one.epub",
+		Text:        "A highlight of the first volume",
+		DateCreated: "2023-01-01T12:00:00Z",
+		Book:        kobo.Book{Title: "Collected Works"},
+	}
+	second := kobo.Bookmark{
+		BookmarkID:  "second",
+		VolumeID:    "file:///mnt/onboard/volume-two.epub",
+		Text:        "A highlight of the second volume",
+		DateCreated: "2023-01-01T12:00:00Z",
+		Book:        kobo.Book{Title: "Collected Works"},
+	}
+
+	// The page of the second volume was recorded, even though it comes after the other in the database
+	store := state.New()
+	store.Set("second", state.Entry{PageID: "second-page", BlockIDs: []string{"second-text"}, Hash: utils.HashBookmark(second)})
+	store.SetBookPage(second.VolumeID, "second-page")
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	mockBlockClient := newCreatedPageBlockClient()
+	service.WithBlockClient(mockBlockClient)
+	service.WithStateStore(store)
+
+	titled := func(id string) notionapi.Page {
+		return notionapi.Page{
+			ID: notionapi.ObjectID(id),
+			Properties: notionapi.Properties{
+				PropBookTitle: &notionapi.TitleProperty{
+					Title: []notionapi.RichText{{PlainText: "Collected Works"}},
+				},
+			},
+		}
+	}
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{titled("other-page"), titled("second-page")},
+	}, nil)
+	mockPageClient.On("Get", mock.Anything, notionapi.PageID("other-page")).Return(&notionapi.Page{ID: "other-page"}, nil)
+	mockBlockClient.On("AppendChildren", mock.Anything, notionapi.BlockID("other-page"), mock.Anything).Return(&notionapi.AppendBlockChildrenResponse{
+		Results: []notionapi.Block{syncedQuoteBlock("first-text", PropHighlightedText, first.Text)},
+	}, nil)
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{first, second})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	// The first volume takes the page left with its title, the second keeps its own untouched
+	mockPageClient.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	mockBlockClient.AssertNotCalled(t, "AppendChildren", mock.Anything, notionapi.BlockID("second-page"), mock.Anything)
+	entry, _ := store.Get("first")
+	assert.Equal(t, "other-page", entry.PageID)
+	entry, _ = store.Get("second")
+	assert.Equal(t, "second-page", entry.PageID)
+	assert.Equal(t, "other-page", store.BookPage(first.VolumeID))
+	assert.Equal(t, "second-page", store.BookPage(second.VolumeID))
+}
+
+func TestAddBookmarksCreatesPageForBookSharingATitle(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	first := kobo.Bookmark{
+		BookmarkID:  "first",
+		VolumeID:    "file:///mnt/onboard/volume-one.epub",
+		Text:        "A highlight of the first volume",
+		DateCreated: "2023-01-01T12:00:00Z",
+		Book:        kobo.Book{Title: "Collected Works"},
+	}
+	second := kobo.Bookmark{
+		BookmarkID:  "second",
+		VolumeID:    "file:///mnt/onboard/volume-two.epub",
+		Text:        "A highlight of the second volume",
+		DateCreated: "2023-01-01T12:00:00Z",
+		Book:        kobo.Book{Title: "Collected Works"},
+	}
+
+	store := state.New()
+	store.Set("first", state.Entry{PageID: "first-page", BlockIDs: []string{"first-text"}, Hash: utils.HashBookmark(first)})
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(newCreatedPageBlockClient())
+	service.WithStateStore(store)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{
+			{
+				ID: "first-page",
+				Properties: notionapi.Properties{
+					PropBookTitle: &notionapi.TitleProperty{
+						Title: []notionapi.RichText{{PlainText: "Collected Works"}},
+					},
+				},
+			},
+		},
+	}, nil)
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "second-page"}, nil)
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{first, second})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	// The page holding the bookmarks of the first volume is not shared with the second
+	mockPageClient.AssertNumberOfCalls(t, "Create", 1)
+	req := mockPageClient.Calls[0].Arguments.Get(1).(*notionapi.PageCreateRequest)
+	assert.Len(t, req.Children, 1, "Only the second volume should be on the new page")
+	entry, _ := store.Get("second")
+	assert.Equal(t, "second-page", entry.PageID)
+	assert.Equal(t, "first-page", store.BookPage(first.VolumeID))
+	assert.Equal(t, "second-page", store.BookPage(second.VolumeID))
+}
+
+func TestAddBookmarksGroupUsesBookMetadata(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(newCreatedPageBlockClient())
+
+	bookmarks := []kobo.Bookmark{
+		{
+			BookmarkID:  "test-bookmark-id-1",
+			VolumeID:    "file:///mnt/onboard/some_file_name_v2.epub",
+			Text:        "This is a test highlight 1",
+			Type:        "highlight",
+			DateCreated: "2023-01-01T12:00:00Z",
+			Book: kobo.Book{
+				Title:     "The Real Title",
+				Author:    "Jane Doe",
+				ISBN:      "9780000000001",
+				Publisher: "Sample Press",
+			},
+		},
+	}
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{}, nil)
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "new-page"}, nil)
+
+	err := service.AddBookmarks("test-db-id", bookmarks)
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	req := mockPageClient.Calls[0].Arguments.Get(1).(*notionapi.PageCreateRequest)
+
+	titleProp, ok := req.Properties[PropBookTitle].(notionapi.TitleProperty)
+	assert.True(t, ok, "Book Title should be a TitleProperty")
+	assert.Equal(t, "The Real Title", titleProp.Title[0].Text.Content)
+
+	authorProp, ok := req.Properties[notion.PropAuthor].(notionapi.RichTextProperty)
+	assert.True(t, ok, "Author should be a RichTextProperty")
+	assert.Equal(t, "Jane Doe", authorProp.RichText[0].Text.Content)
+
+	assert.Contains(t, req.Properties, notion.PropISBN)
+	assert.Contains(t, req.Properties, notion.PropPublisher)
+}
+
+// syncedQuoteBlock builds a quote block as returned by the API for a synced highlight
+func syncedQuoteBlock(id string, label string, text string) *notionapi.QuoteBlock {
+	return &notionapi.QuoteBlock{
+		BasicBlock: notionapi.BasicBlock{
+			Object: notionapi.ObjectTypeBlock,
+			ID:     notionapi.BlockID(id),
+			Type:   notionapi.BlockTypeQuote,
+		},
+		Quote: notionapi.Quote{
+			RichText: []notionapi.RichText{
+				{PlainText: label, Annotations: &notionapi.Annotations{Bold: true}},
+				{PlainText: "\n"},
+				{PlainText: text},
+			},
+		},
+	}
+}
+
+func TestUpdateBookPageKeepsUserBlocks(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+	mockBlockClient := &MockBlockClient{}
+
+	// Only the removed highlight was synced before, full syncs read the page again
+	store := state.New()
+	store.Set("removed-bookmark", state.Entry{PageID: "existing-page", BlockIDs: []string{"synced-removed"}, Hash: "old-hash"})
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(mockBlockClient)
+	service.WithStateStore(store)
+	service.WithFullSync(true)
+
+	bookmarks := []kobo.Bookmark{
+		{
+			BookmarkID:  "test-bookmark-id-1",
+			VolumeID:    "test-volume-id",
+			Text:        "This is a test highlight 1",
+			Type:        "highlight",
+			DateCreated: "2023-01-01T12:00:00Z",
+		},
+	}
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{
+			{
+				ID: "existing-page",
+				Properties: notionapi.Properties{
+					PropBookTitle: &notionapi.TitleProperty{
+						Title: []notionapi.RichText{{PlainText: "test-volume-id"}},
+					},
+				},
+			},
+		},
+	}, nil)
+
+	mockPageClient.On("Get", mock.Anything, notionapi.PageID("existing-page")).Return(&notionapi.Page{ID: "existing-page"}, nil)
+
+	userHeading := &notionapi.Heading2Block{
+		BasicBlock: notionapi.BasicBlock{ID: "user-heading", Type: notionapi.BlockTypeHeading2},
+		Heading2: notionapi.Heading{
+			RichText: []notionapi.RichText{{PlainText: "My summary"}},
+		},
+	}
+	userQuote := &notionapi.QuoteBlock{
+		BasicBlock: notionapi.BasicBlock{ID: "user-quote", Type: notionapi.BlockTypeQuote},
+		Quote: notionapi.Quote{
+			RichText: []notionapi.RichText{{PlainText: "A quote I typed myself"}},
+		},
+	}
+
+	mockBlockClient.On("GetChildren", mock.Anything, notionapi.BlockID("existing-page"), mock.Anything).Return(&notionapi.GetChildrenResponse{
+		Results: []notionapi.Block{
+			userHeading,
+			syncedQuoteBlock("synced-current", PropHighlightedText, "This is a test highlight 1"),
+			userQuote,
+			syncedQuoteBlock("synced-removed", PropHighlightedText, "A highlight deleted on the Kobo"),
+			syncedQuoteBlock("user-labeled", PropHighlightedText, "A paragraph I wrote like a highlight"),
+		},
+	}, nil)
+
+	mockBlockClient.On("Delete", mock.Anything, notionapi.BlockID("synced-removed")).Return(syncedQuoteBlock("synced-removed", PropHighlightedText, ""), nil)
+
+	err := service.AddBookmarks("test-db-id", bookmarks)
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	mockBlockClient.AssertExpectations(t)
+	mockBlockClient.AssertNotCalled(t, "Delete", mock.Anything, notionapi.BlockID("user-heading"))
+	mockBlockClient.AssertNotCalled(t, "Delete", mock.Anything, notionapi.BlockID("user-quote"))
+	mockBlockClient.AssertNotCalled(t, "AppendChildren", mock.Anything, mock.Anything, mock.Anything)
+
+	// Blocks looking synced but never tracked may be the user's own
+	mockBlockClient.AssertNotCalled(t, "Delete", mock.Anything, notionapi.BlockID("user-labeled"))
+}
+
+func TestUpdateBookPageWithStateStore(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+	mockBlockClient := &MockBlockClient{}
+
+	unchanged := kobo.Bookmark{
+		BookmarkID:  "unchanged",
+		VolumeID:    "test-volume-id",
+		Text:        "An unchanged highlight",
+		DateCreated: "2023-01-01T12:00:00Z",
+	}
+	edited := kobo.Bookmark{
+		BookmarkID:  "edited",
+		VolumeID:    "test-volume-id",
+		Text:        "An annotated highlight",
+		Annotation:  "The edited note",
+		DateCreated: "2023-01-01T12:00:00Z",
+	}
+
+	store := state.New()
+	store.Set("unchanged", state.Entry{PageID: "existing-page", BlockIDs: []string{"unchanged-text"}, Hash: utils.HashBookmark(unchanged)})
+	store.Set("edited", state.Entry{PageID: "existing-page", BlockIDs: []string{"edited-text"}, Hash: "outdated"})
+	store.Set("removed", state.Entry{PageID: "existing-page", BlockIDs: []string{"removed-text"}, Hash: "removed"})
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(mockBlockClient)
+	service.WithStateStore(store)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{
+			{
+				ID: "existing-page",
+				Properties: notionapi.Properties{
+					PropBookTitle: &notionapi.TitleProperty{
+						Title: []notionapi.RichText{{PlainText: "test-volume-id"}},
+					},
+				},
+			},
+		},
+	}, nil)
+
+	editedText := syncedQuoteBlock("edited-text", PropHighlightedText, "")
+	editedText.HasChildren = true
+	mockBlockClient.On("Update", mock.Anything, notionapi.BlockID("edited-text"), mock.Anything).Return(editedText, nil)
+	mockBlockClient.On("GetChildren", mock.Anything, notionapi.BlockID("edited-text"), mock.Anything).Return(&notionapi.GetChildrenResponse{
+		Results: []notionapi.Block{syncedQuoteBlock("edited-note", PropAnnotation, "The old note")},
+	}, nil)
+	mockBlockClient.On("Update", mock.Anything, notionapi.BlockID("edited-note"), mock.Anything).Return(syncedQuoteBlock("edited-note", PropAnnotation, ""), nil)
+	mockBlockClient.On("Delete", mock.Anything, notionapi.BlockID("removed-text")).Return(syncedQuoteBlock("removed-text", PropHighlightedText, ""), nil)
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{unchanged, edited})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	mockBlockClient.AssertExpectations(t)
+	mockBlockClient.AssertNotCalled(t, "GetChildren", mock.Anything, notionapi.BlockID("existing-page"), mock.Anything)
+	mockBlockClient.AssertNotCalled(t, "AppendChildren", mock.Anything, mock.Anything, mock.Anything)
+	mockPageClient.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+
+	entry, ok := store.Get("edited")
+	assert.True(t, ok, "Edited bookmark should still be tracked")
+	assert.Equal(t, utils.HashBookmark(edited), entry.Hash)
+	assert.Equal(t, []string{"edited-text"}, entry.BlockIDs)
+
+	_, ok = store.Get("removed")
+	assert.False(t, ok, "Removed bookmark should be forgotten")
+}
+
+func TestAddBookmarksDeletesHighlightRemovedAfterCreation(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+	mockBlockClient := &MockBlockClient{}
+
+	kept := kobo.Bookmark{
+		BookmarkID:  "kept",
+		VolumeID:    "test-volume-id",
+		Text:        "A kept highlight",
+		DateCreated: "2023-01-01T12:00:00Z",
+	}
+	removed := kobo.Bookmark{
+		BookmarkID:  "removed",
+		VolumeID:    "test-volume-id",
+		Text:        "A removed highlight",
+		DateCreated: "2023-01-02T12:00:00Z",
+	}
+
+	store := state.New()
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(mockBlockClient)
+	service.WithStateStore(store)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{}, nil).Once()
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "new-page"}, nil)
+	mockBlockClient.On("GetChildren", mock.Anything, notionapi.BlockID("new-page"), mock.Anything).Return(&notionapi.GetChildrenResponse{
+		Results: []notionapi.Block{
+			syncedQuoteBlock("kept-text", PropHighlightedText, ""),
+			syncedQuoteBlock("removed-text", PropHighlightedText, ""),
+		},
+	}, nil)
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{kept, removed})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	entry, ok := store.Get("removed")
+	assert.True(t, ok, "Created bookmark should be tracked")
+	assert.Equal(t, []string{"removed-text"}, entry.BlockIDs, "Created blocks should be recorded")
+
+	// The highlight is removed on the reader before the page is ever updated
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{
+			{
+				ID: "new-page",
+				Properties: notionapi.Properties{
+					PropBookTitle: &notionapi.TitleProperty{
+						Title: []notionapi.RichText{{PlainText: "test-volume-id"}},
+					},
+				},
+			},
+		},
+	}, nil)
+	mockBlockClient.On("Delete", mock.Anything, notionapi.BlockID("removed-text")).Return(syncedQuoteBlock("removed-text", PropHighlightedText, ""), nil)
+
+	err = service.AddBookmarks("test-db-id", []kobo.Bookmark{kept})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	mockBlockClient.AssertCalled(t, "Delete", mock.Anything, notionapi.BlockID("removed-text"))
+	mockBlockClient.AssertNotCalled(t, "Delete", mock.Anything, notionapi.BlockID("kept-text"))
+
+	_, ok = store.Get("removed")
+	assert.False(t, ok, "Removed bookmark should be forgotten")
+}
+
+func TestAddBookmarksSkipsUnchangedBooks(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+	mockBlockClient := &MockBlockClient{}
+
+	synced := kobo.Bookmark{
+		BookmarkID:   "synced",
+		VolumeID:     "test-volume-id",
+		Text:         "A highlight synced last time",
+		DateCreated:  "2023-01-01T12:00:00Z",
+		DateModified: "2023-01-01T12:00:00Z",
+	}
+
+	store := state.New()
+	store.Watermark, _ = utils.ParseKoboBookmarkDate("2023-01-02T12:00:00Z")
+	store.Set("synced", state.Entry{PageID: "existing-page", BlockIDs: []string{"synced-text"}, Hash: utils.HashBookmark(synced)})
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(mockBlockClient)
+	service.WithStateStore(store)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{
+			{
+				ID: "existing-page",
+				Properties: notionapi.Properties{
+					PropBookTitle: &notionapi.TitleProperty{
+						Title: []notionapi.RichText{{PlainText: "test-volume-id"}},
+					},
+				},
+			},
+		},
+	}, nil)
+
+	// Unchanged book, nothing is read or written
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{synced})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+	mockPageClient.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+	mockBlockClient.AssertNotCalled(t, "GetChildren", mock.Anything, mock.Anything, mock.Anything)
+
+	// A full sync re-reads the page even without changes
+	mockPageClient.On("Get", mock.Anything, notionapi.PageID("existing-page")).Return(&notionapi.Page{ID: "existing-page"}, nil)
+	mockBlockClient.On("GetChildren", mock.Anything, notionapi.BlockID("existing-page"), mock.Anything).Return(&notionapi.GetChildrenResponse{
+		Results: []notionapi.Block{
+			syncedQuoteBlock("synced-text", PropHighlightedText, "A highlight synced last time"),
+		},
+	}, nil)
+
+	service.WithFullSync(true)
+	err = service.AddBookmarks("test-db-id", []kobo.Bookmark{synced})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+	mockBlockClient.AssertCalled(t, "GetChildren", mock.Anything, notionapi.BlockID("existing-page"), mock.Anything)
+	mockBlockClient.AssertNotCalled(t, "AppendChildren", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestAddBookmarksAdvancesWatermark(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	store := state.New()
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(newCreatedPageBlockClient())
+	service.WithStateStore(store)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{}, nil)
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "new-page"}, nil)
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{
+		{BookmarkID: "bm1", VolumeID: "vol", Text: "One", DateCreated: "2023-01-01T12:00:00Z", DateModified: "2023-03-01T12:00:00Z"},
+		{BookmarkID: "bm2", VolumeID: "vol", Text: "Two", DateCreated: "2023-02-01T12:00:00Z", DateModified: "2023-02-01T12:00:00Z"},
+	})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	expected, _ := utils.ParseKoboBookmarkDate("2023-03-01T12:00:00Z")
+	assert.True(t, store.Watermark.Equal(expected), "Watermark should be the latest modification date")
+	assert.False(t, store.LastSync.IsZero(), "The time of the sync should be recorded")
+}
+
+func TestAddBookmarksFlat(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+
+	bookmarks := []kobo.Bookmark{
+		{
+			BookmarkID:  "already-synced",
+			VolumeID:    "test-volume-id",
+			Text:        "An old highlight",
+			Type:        "highlight",
+			DateCreated: "2023-01-01T12:00:00Z",
+		},
+		{
+			BookmarkID:  "new-bookmark",
+			VolumeID:    "test-volume-id",
+			Text:        "A new highlight",
+			Annotation:  "A new note",
+			Type:        "highlight",
+			DateCreated: "2023-01-02T12:00:00Z",
+		},
+	}
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{
+			{
+				Properties: notionapi.Properties{
+					PropBookmarkID: &notionapi.RichTextProperty{
+						RichText: []notionapi.RichText{{PlainText: "already-synced"}},
+					},
+				},
+			},
+		},
+	}, nil)
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "new-row"}, nil)
+
+	err := service.AddBookmarksFlat("test-db-id", bookmarks)
+	assert.NoError(t, err, "AddBookmarksFlat should not return an error")
+
+	// Only the new bookmark gets a row
+	mockPageClient.AssertNumberOfCalls(t, "Create", 1)
+	req := mockPageClient.Calls[0].Arguments.Get(1).(*notionapi.PageCreateRequest)
+
+	titleProp, ok := req.Properties[PropBookTitle].(notionapi.TitleProperty)
+	assert.True(t, ok, "Book Title should be a TitleProperty")
+	assert.Equal(t, "test-volume-id", titleProp.Title[0].Text.Content)
+
+	for prop, expected := range map[string]string{
+		PropBookmarkID:      "new-bookmark",
+		PropHighlightedText: "A new highlight",
+		PropAnnotation:      "A new note",
+		PropType:            "highlight",
+	} {
+		richText, ok := req.Properties[prop].(notionapi.RichTextProperty)
+		assert.True(t, ok, "%s should be a RichTextProperty", prop)
+		assert.Equal(t, expected, richText.RichText[0].Text.Content)
+	}
+
+	assert.Contains(t, req.Properties, PropDateCreated)
+}
+
+// manyBookmarks creates count bookmarks with a highlight and an annotation each
+func manyBookmarks(count int) []kobo.Bookmark {
+	var bookmarks []kobo.Bookmark
+	for i := 0; i < count; i++ {
+		bookmarks = append(bookmarks, kobo.Bookmark{
+			BookmarkID:  fmt.Sprintf("bookmark-%d", i),
+			VolumeID:    "test-volume-id",
+			Text:        fmt.Sprintf("Highlight %d", i),
+			Annotation:  fmt.Sprintf("Annotation %d", i),
+			Type:        "highlight",
+			DateCreated: "2023-01-01T12:00:00Z",
+		})
+	}
+	return bookmarks
+}
+
+func TestCreateBookPageChunksChildren(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+	mockBlockClient := newCreatedPageBlockClient()
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(mockBlockClient)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{}, nil)
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "new-page"}, nil)
+	mockBlockClient.On("AppendChildren", mock.Anything, notionapi.BlockID("new-page"), mock.Anything).Return(&notionapi.AppendBlockChildrenResponse{}, nil)
+
+	// 120 bookmarks render 120 blocks
+	err := service.AddBookmarks("test-db-id", manyBookmarks(120))
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	req := mockPageClient.Calls[0].Arguments.Get(1).(*notionapi.PageCreateRequest)
+	assert.Len(t, req.Children, 100, "Page creation should carry at most 100 blocks")
+
+	mockBlockClient.AssertNumberOfCalls(t, "AppendChildren", 1)
+	appendReq := mockBlockClient.Calls[0].Arguments.Get(2).(*notionapi.AppendBlockChildrenRequest)
+	assert.Len(t, appendReq.Children, 20, "Remaining blocks should be appended after creation")
+	assert.Equal(t, "Highlight 100", appendReq.Children[0].(*notionapi.QuoteBlock).Quote.RichText[2].Text.Content, "Order should be preserved")
+}
+
+func TestUpdateBookPageChunksAppends(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+	mockBlockClient := &MockBlockClient{}
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(mockBlockClient)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{
+			{
+				ID: "existing-page",
+				Properties: notionapi.Properties{
+					PropBookTitle: &notionapi.TitleProperty{
+						Title: []notionapi.RichText{{PlainText: "test-volume-id"}},
+					},
+				},
+			},
+		},
+	}, nil)
+	mockPageClient.On("Get", mock.Anything, notionapi.PageID("existing-page")).Return(&notionapi.Page{ID: "existing-page"}, nil)
+	mockBlockClient.On("GetChildren", mock.Anything, notionapi.BlockID("existing-page"), mock.Anything).Return(&notionapi.GetChildrenResponse{}, nil)
+	mockBlockClient.On("AppendChildren", mock.Anything, notionapi.BlockID("existing-page"), mock.Anything).Return(&notionapi.AppendBlockChildrenResponse{}, nil)
+
+	// 150 bookmarks render 150 blocks
+	err := service.AddBookmarks("test-db-id", manyBookmarks(150))
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	var batchSizes []int
+	for _, call := range mockBlockClient.Calls {
+		if call.Method == "AppendChildren" {
+			batchSizes = append(batchSizes, len(call.Arguments.Get(2).(*notionapi.AppendBlockChildrenRequest).Children))
+		}
+	}
+	assert.Equal(t, []int{100, 50}, batchSizes)
+}
+
+func TestLongHighlightRespectsRichTextLimit(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(newCreatedPageBlockClient())
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{}, nil)
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "new-page"}, nil)
+
+	// 150 chunks of 2000 characters do not fit in a single block
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{
+		{
+			BookmarkID:  "long",
+			VolumeID:    "test-volume-id",
+			Text:        strings.Repeat("a", 150*2000),
+			DateCreated: "2023-01-01T12:00:00Z",
+		},
+	})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	req := mockPageClient.Calls[0].Arguments.Get(1).(*notionapi.PageCreateRequest)
+	assert.Len(t, req.Children, 1, "Long highlight should render as a single block")
+	quote := req.Children[0].(*notionapi.QuoteBlock)
+	assert.Len(t, quote.Quote.Children, 1, "Long highlight should continue in a nested block")
+
+	total := 0
+	for _, child := range append([]notionapi.Block{quote}, quote.Quote.Children...) {
+		richText := child.(*notionapi.QuoteBlock).Quote.RichText
+		assert.LessOrEqual(t, len(richText), 100, "Blocks should hold at most 100 rich text objects")
+		assert.Equal(t, PropHighlightedText, richText[0].Text.Content, "Every block should start with the label")
+		for _, text := range richText[2:] {
+			total += len(text.Text.Content)
+		}
+	}
+	assert.Equal(t, 150*2000, total, "No text should be lost")
+}
+
+func TestPlanBookmarksMakesNoWrites(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+	mockBlockClient := &MockBlockClient{}
+
+	edited := kobo.Bookmark{
+		BookmarkID:  "edited",
+		VolumeID:    "test-volume-id",
+		Text:        "An edited highlight",
+		DateCreated: "2023-01-01T12:00:00Z",
+	}
+	added := kobo.Bookmark{
+		BookmarkID:  "added",
+		VolumeID:    "test-volume-id",
+		Text:        "A new highlight",
+		DateCreated: "2023-01-01T12:00:00Z",
+	}
+	newBook := kobo.Bookmark{
+		BookmarkID:  "new-book",
+		VolumeID:    "new-volume-id",
+		Text:        "A highlight in a new book",
+		DateCreated: "2023-01-01T12:00:00Z",
+	}
+
+	store := state.New()
+	store.Set("edited", state.Entry{PageID: "existing-page", BlockIDs: []string{"edited-text"}, Hash: "outdated"})
+	store.Set("removed", state.Entry{PageID: "existing-page", BlockIDs: []string{"removed-text"}, Hash: "removed"})
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(mockBlockClient)
+	service.WithStateStore(store)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{
+			{
+				ID: "existing-page",
+				Properties: notionapi.Properties{
+					PropBookTitle: &notionapi.TitleProperty{
+						Title: []notionapi.RichText{{PlainText: "test-volume-id"}},
+					},
+				},
+			},
+			{
+				ID: "removed-page",
+				Properties: notionapi.Properties{
+					PropBookTitle: &notionapi.TitleProperty{
+						Title: []notionapi.RichText{{PlainText: "removed-volume-id"}},
+					},
+				},
+			},
+		},
+	}, nil)
+
+	plan, err := service.PlanBookmarks("test-db-id", []kobo.Bookmark{edited, added, newBook})
+	assert.NoError(t, err, "PlanBookmarks should not return an error")
+
+	mockPageClient.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	mockPageClient.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+	mockBlockClient.AssertNotCalled(t, "AppendChildren", mock.Anything, mock.Anything, mock.Anything)
+	mockBlockClient.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+	mockBlockClient.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+
+	// Planning leaves the state store untouched
+	entry, ok := store.Get("edited")
+	assert.True(t, ok)
+	assert.Equal(t, "outdated", entry.Hash)
+
+	text := plan.String()
+	assert.Contains(t, text, "1 pages to create, 1 to update, 1 to archive")
+	assert.Contains(t, text, `+ create "new-volume-id"`)
+	assert.Contains(t, text, `~ update "test-volume-id"`)
+	assert.Contains(t, text, `~ update edited: "An edited highlight"`)
+	assert.Contains(t, text, `+ add added: "A new highlight"`)
+	assert.Contains(t, text, "- delete removed (1 blocks)")
+	assert.Contains(t, text, `- archive "removed-volume-id"`)
+
+	output, err := plan.JSON()
+	assert.NoError(t, err)
+
+	var decoded notion.Plan
+	assert.NoError(t, json.Unmarshal(output, &decoded))
+	assert.Equal(t, notion.PlanModeGrouped, decoded.Mode)
+	assert.Len(t, decoded.Pages, 3)
+	assert.Equal(t, notion.PageCreate, decoded.Pages[0].Action)
+	assert.Equal(t, notion.PageUpdate, decoded.Pages[1].Action)
+	assert.Equal(t, notion.PageArchive, decoded.Pages[2].Action)
+	assert.Equal(t, "removed-page", decoded.Pages[2].PageID)
+}
+
+func TestCheckDatabase(t *testing.T) {
+	mockDBClient := new(MockDatabaseClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+
+	mockDBClient.On("Get", mock.Anything, notionapi.DatabaseID("test-db-id")).Return(&notionapi.Database{
+		Title: []notionapi.RichText{{PlainText: "Highlights"}},
+	}, nil)
+	mockDBClient.On("Get", mock.Anything, notionapi.DatabaseID("missing-db-id")).Return((*notionapi.Database)(nil), fmt.Errorf("object_not_found"))
+
+	title, err := service.CheckDatabase("test-db-id")
+	assert.NoError(t, err)
+	assert.Equal(t, "Highlights", title)
+
+	_, err = service.CheckDatabase("missing-db-id")
+	assert.Error(t, err)
+}
+
+func TestValidateSchema(t *testing.T) {
+	mockDBClient := new(MockDatabaseClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+
+	mockDBClient.On("Get", mock.Anything, notionapi.DatabaseID("test-db-id")).Return(&notionapi.Database{
+		Properties: notionapi.PropertyConfigs{
+			"Name":          notionapi.TitlePropertyConfig{Type: notionapi.PropertyConfigTypeTitle},
+			PropBookName:    notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText},
+			"Author":        notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText},
+			"ISBN":          notionapi.NumberPropertyConfig{Type: notionapi.PropertyConfigTypeNumber},
+			"Publisher":     notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText},
+			PropDateCreated: notionapi.DatePropertyConfig{Type: notionapi.PropertyConfigTypeDate},
+		},
+	}, nil)
+
+	issues, err := service.ValidateSchema("test-db-id", notion.PlanModeGrouped)
+	assert.NoError(t, err)
+	assert.Equal(t, []notion.SchemaIssue{
+		{Property: PropBookTitle, Expected: notionapi.PropertyConfigTypeTitle, Actual: notionapi.PropertyConfigTypeTitle, CurrentName: "Name"},
+		{Property: "ISBN", Expected: notionapi.PropertyConfigTypeRichText, Actual: notionapi.PropertyConfigTypeNumber},
+	}, issues)
+
+	// Flat mode also writes the highlight itself to properties
+	issues, err = service.ValidateSchema("test-db-id", notion.PlanModeFlat)
+	assert.NoError(t, err)
+	assert.Len(t, issues, 6)
+	assert.Equal(t, `missing property "Highlighted Text" of type rich_text`, issues[2].String())
+}
+
+func TestValidateSchemaSkipsOptionalProperties(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(newCreatedPageBlockClient())
+
+	mockDBClient.On("Update", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.Database{}, nil)
+
+	// A database made before the author, ISBN and publisher properties existed
+	mockDBClient.On("Get", mock.Anything, notionapi.DatabaseID("test-db-id")).Return(&notionapi.Database{
+		Properties: notionapi.PropertyConfigs{
+			PropBookTitle:   notionapi.TitlePropertyConfig{Type: notionapi.PropertyConfigTypeTitle},
+			PropBookName:    notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText},
+			PropDateCreated: notionapi.DatePropertyConfig{Type: notionapi.PropertyConfigTypeDate},
+			"Author":        notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText},
+		},
+	}, nil)
+
+	issues, err := service.ValidateSchema("test-db-id", notion.PlanModeGrouped)
+	assert.NoError(t, err)
+	assert.Empty(t, issues)
+
+	// Validating has no effect on the properties written, dropping them is an explicit step
+	issues, err = service.FixSchema("test-db-id", notion.PlanModeGrouped)
+	assert.NoError(t, err)
+	assert.Empty(t, issues)
+	mockDBClient.AssertCalled(t, "Update", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.MatchedBy(func(req *notionapi.DatabaseUpdateRequest) bool {
+		return len(req.Properties) == 2 && req.Properties["ISBN"] != nil && req.Properties["Publisher"] != nil
+	}))
+
+	assert.NoError(t, service.DropMissingOptionalProperties("test-db-id"))
+
+	// Only the optional properties the database has are written
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{}, nil)
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "new-page"}, nil)
+
+	err = service.AddBookmarks("test-db-id", []kobo.Bookmark{{
+		BookmarkID:  "bm1",
+		VolumeID:    "vol1",
+		Text:        "A highlight",
+		DateCreated: "2023-01-01T12:00:00Z",
+		Book:        kobo.Book{Title: "A Book", Author: "Jane Doe", ISBN: "123", Publisher: "Press"},
+	}})
+	assert.NoError(t, err)
+
+	req := mockPageClient.Calls[0].Arguments.Get(1).(*notionapi.PageCreateRequest)
+	assert.Contains(t, req.Properties, "Author")
+	assert.NotContains(t, req.Properties, "ISBN")
+	assert.NotContains(t, req.Properties, "Publisher")
+}
+
+func TestFixSchema(t *testing.T) {
+	mockDBClient := new(MockDatabaseClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+
+	mockDBClient.On("Get", mock.Anything, notionapi.DatabaseID("test-db-id")).Return(&notionapi.Database{
+		Properties: notionapi.PropertyConfigs{
+			"Name":       notionapi.TitlePropertyConfig{Type: notionapi.PropertyConfigTypeTitle},
+			PropBookName: notionapi.NumberPropertyConfig{Type: notionapi.PropertyConfigTypeNumber},
+		},
+	}, nil)
+	mockDBClient.On("Update", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.Database{}, nil)
+
+	remaining, err := service.FixSchema("test-db-id", notion.PlanModeGrouped)
+	assert.NoError(t, err)
+
+	// Converting the type of a property would change its values, it is left to the user
+	assert.Len(t, remaining, 1)
+	assert.Equal(t, PropBookName, remaining[0].Property)
+
+	mockDBClient.AssertNumberOfCalls(t, "Update", 1)
+	request := mockDBClient.Calls[1].Arguments.Get(2).(*notionapi.DatabaseUpdateRequest)
+
+	body, err := json.Marshal(request.Properties)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `"Name":{"name":"Book Title"}`)
+	assert.Contains(t, string(body), `"Author":{"type":"rich_text","rich_text":{}}`)
+	assert.Contains(t, string(body), `"Date Created":{"type":"date","date":{}}`)
+	assert.NotContains(t, string(body), `"Book Name"`)
+}
+
+func TestCreateDatabase(t *testing.T) {
+	mockDBClient := new(MockDatabaseClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+
+	mockDBClient.On("Create", mock.Anything, mock.MatchedBy(func(req *notionapi.DatabaseCreateRequest) bool {
+		_, hasTitle := req.Properties[PropBookTitle]
+		_, hasBookmarkID := req.Properties[PropBookmarkID]
+		return req.Parent.PageID == "parent-page" && hasTitle && hasBookmarkID && len(req.Properties) == 10
+	})).Return(&notionapi.Database{ID: "new-db-id"}, nil)
+
+	databaseID, err := service.CreateDatabase("parent-page", "Kobo Highlights", notion.PlanModeFlat)
+	assert.NoError(t, err)
+	assert.Equal(t, "new-db-id", databaseID)
+	mockDBClient.AssertExpectations(t)
+}
+
+func TestAddBookmarksUsesPropertyMapping(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	properties, err := config.ParseProperties("title=Name,author=Writer:select,book_name=,highlight_count=Highlights")
+	assert.NoError(t, err)
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(newCreatedPageBlockClient())
+	service.WithProperties(properties)
+
+	bookmarks := []kobo.Bookmark{
+		{BookmarkID: "bm1", VolumeID: "vol1", Text: "First", DateCreated: "2023-01-01T12:00:00Z", Book: kobo.Book{Title: "Mapped Book", Author: "Jane Doe"}},
+		{BookmarkID: "bm2", VolumeID: "vol1", Text: "Second", DateCreated: "2023-01-02T12:00:00Z", Book: kobo.Book{Title: "Mapped Book", Author: "Jane Doe"}},
+	}
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{}, nil)
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "new-page"}, nil)
+
+	err = service.AddBookmarks("test-db-id", bookmarks)
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	req := mockPageClient.Calls[0].Arguments.Get(1).(*notionapi.PageCreateRequest)
+
+	titleProp, ok := req.Properties["Name"].(notionapi.TitleProperty)
+	assert.True(t, ok, "Name should be a TitleProperty")
+	assert.Equal(t, "Mapped Book", titleProp.Title[0].Text.Content)
+
+	authorProp, ok := req.Properties["Writer"].(notionapi.SelectProperty)
+	assert.True(t, ok, "Writer should be a SelectProperty")
+	assert.Equal(t, "Jane Doe", authorProp.Select.Name)
+
+	countProp, ok := req.Properties["Highlights"].(notionapi.NumberProperty)
+	assert.True(t, ok, "Highlights should be a NumberProperty")
+	assert.Equal(t, float64(2), countProp.Number)
+
+	assert.NotContains(t, req.Properties, PropBookTitle)
+	assert.NotContains(t, req.Properties, PropBookName)
+	assert.Contains(t, req.Properties, PropDateCreated)
+}
+
+func TestUpdateBookPagePropertiesOnChange(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	properties, err := config.ParseProperties("highlight_count=Highlights")
+	assert.NoError(t, err)
+
+	bookmark := kobo.Bookmark{
+		BookmarkID:  "synced",
+		VolumeID:    "test-volume-id",
+		Text:        "A synced highlight",
+		DateCreated: "2023-01-01T12:00:00Z",
+	}
+
+	store := state.New()
+	store.Set("synced", state.Entry{PageID: "existing-page", BlockIDs: []string{"synced-text"}, Hash: utils.HashBookmark(bookmark)})
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+	mockBlockClient := &MockBlockClient{}
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(mockBlockClient)
+	service.WithStateStore(store)
+	service.WithProperties(properties)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{
+			{
+				ID: "existing-page",
+				Properties: notionapi.Properties{
+					PropBookTitle: &notionapi.TitleProperty{
+						Title: []notionapi.RichText{{PlainText: "test-volume-id"}},
+					},
+				},
+			},
+		},
+	}, nil)
+	mockPageClient.On("Update", mock.Anything, notionapi.PageID("existing-page"), mock.MatchedBy(func(req *notionapi.PageUpdateRequest) bool {
+		count, ok := req.Properties["Highlights"].(notionapi.NumberProperty)
+		return ok && count.Number == 1
+	})).Return(&notionapi.Page{ID: "existing-page"}, nil).Once()
+
+	err = service.AddBookmarks("test-db-id", []kobo.Bookmark{bookmark})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+	mockPageClient.AssertExpectations(t)
+	assert.NotEmpty(t, store.PageHash("existing-page"), "Page properties should be tracked")
+
+	// Unchanged properties are not written again
+	plan, err := service.PlanBookmarks("test-db-id", []kobo.Bookmark{bookmark})
+	assert.NoError(t, err)
+	for _, page := range plan.Pages {
+		assert.False(t, page.HasChanges(), "Unchanged book should have no changes")
+	}
+}
+
+// bookPage builds a book page of the database as returned by a query
+func bookPage(id string, title string) notionapi.Page {
+	return notionapi.Page{
+		ID: notionapi.ObjectID(id),
+		Properties: notionapi.Properties{
+			PropBookTitle: &notionapi.TitleProperty{
+				Title: []notionapi.RichText{{PlainText: title}},
+			},
+		},
+	}
+}
+
+// chapterBookmark builds a bookmark made in a chapter of the test volume
+func chapterBookmark(id string, chapterIndex int, chapterTitle string, path string) kobo.Bookmark {
+	return kobo.Bookmark{
+		BookmarkID:         id,
+		VolumeID:           "test-volume-id",
+		Text:               "Highlight " + id,
+		Type:               "highlight",
+		DateCreated:        "2023-01-01T12:00:00Z",
+		ContentID:          fmt.Sprintf("test-volume-id!ch%d.xhtml", chapterIndex),
+		ChapterTitle:       chapterTitle,
+		ChapterIndex:       chapterIndex,
+		StartContainerPath: path,
+	}
+}
+
+func TestCreateBookPageWithChapterHeadings(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(newCreatedPageBlockClient())
+
+	// Bookmarks come from the Kobo newest first
+	bookmarks := []kobo.Bookmark{
+		chapterBookmark("ch2-a", 2, "Chapter Two", "span#kobo\\.1\\.1"),
+		chapterBookmark("ch1-b", 1, "Chapter One", "span#kobo\\.12\\.1"),
+		chapterBookmark("ch1-a", 1, "Chapter One", "span#kobo\\.3\\.1"),
+	}
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{}, nil)
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "new-page"}, nil)
+
+	err := service.AddBookmarks("test-db-id", bookmarks)
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	req := mockPageClient.Calls[0].Arguments.Get(1).(*notionapi.PageCreateRequest)
+
+	var layout []string
+	for _, block := range req.Children {
+		switch b := block.(type) {
+		case *notionapi.Heading2Block:
+			layout = append(layout, "# "+b.Heading2.RichText[0].Text.Content)
+		case *notionapi.QuoteBlock:
+			layout = append(layout, b.Quote.RichText[2].Text.Content)
+		}
+	}
+	assert.Equal(t, []string{"# Chapter One", "Highlight ch1-a", "Highlight ch1-b", "# Chapter Two", "Highlight ch2-a"}, layout)
+}
+
+func TestUpdateBookPageChapterHeadings(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	existing := chapterBookmark("ch1-a", 1, "Chapter One", "span#kobo\\.3\\.1")
+	added := chapterBookmark("ch2-a", 2, "Chapter Two", "span#kobo\\.1\\.1")
+
+	store := state.New()
+	store.Set("ch1-a", state.Entry{PageID: "existing-page", BlockIDs: []string{"ch1-a-text"}, Hash: utils.HashBookmark(existing)})
+	store.Set("ch3-a", state.Entry{PageID: "existing-page", BlockIDs: []string{"ch3-a-text"}, Hash: "removed"})
+	store.SetChapter("existing-page", existing.ContentID, "ch1-heading")
+	store.SetChapter("existing-page", "test-volume-id!ch3.xhtml", "ch3-heading")
+
+	mockDBClient := new(MockDatabaseClient)
+	mockBlockClient := &MockBlockClient{}
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(new(MockPageClient))
+	service.WithBlockClient(mockBlockClient)
+	service.WithStateStore(store)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{
+			{
+				ID: "existing-page",
+				Properties: notionapi.Properties{
+					PropBookTitle: &notionapi.TitleProperty{
+						Title: []notionapi.RichText{{PlainText: "test-volume-id"}},
+					},
+				},
+			},
+		},
+	}, nil)
+	mockBlockClient.On("Delete", mock.Anything, notionapi.BlockID("ch3-a-text")).Return(syncedQuoteBlock("ch3-a-text", PropHighlightedText, ""), nil)
+	mockBlockClient.On("Delete", mock.Anything, notionapi.BlockID("ch3-heading")).Return(&notionapi.Heading2Block{}, nil)
+	mockBlockClient.On("AppendChildren", mock.Anything, notionapi.BlockID("existing-page"), mock.MatchedBy(func(req *notionapi.AppendBlockChildrenRequest) bool {
+		heading, ok := req.Children[0].(*notionapi.Heading2Block)
+		return len(req.Children) == 2 && ok && heading.Heading2.RichText[0].Text.Content == "Chapter Two"
+	})).Return(&notionapi.AppendBlockChildrenResponse{
+		Results: []notionapi.Block{
+			&notionapi.Heading2Block{BasicBlock: notionapi.BasicBlock{ID: "ch2-heading"}},
+			syncedQuoteBlock("ch2-a-text", PropHighlightedText, "Highlight ch2-a"),
+		},
+	}, nil)
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{existing, added})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+	mockBlockClient.AssertExpectations(t)
+
+	assert.Equal(t, map[string]string{
+		existing.ContentID: "ch1-heading",
+		added.ContentID:    "ch2-heading",
+	}, store.PageChapters("existing-page"))
+
+	entry, ok := store.Get("ch2-a")
+	assert.True(t, ok, "New bookmark should be tracked")
+	assert.Equal(t, []string{"ch2-a-text"}, entry.BlockIDs)
+}
+
+func TestFullSyncIgnoresUserChapterHeadings(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	first := chapterBookmark("first", 1, "Chapter One", "span#kobo\\.1\\.1")
+	second := chapterBookmark("second", 2, "Chapter Two", "span#kobo\\.1\\.1")
+
+	store := state.New()
+	store.Set("first", state.Entry{PageID: "existing-page", BlockIDs: []string{"first-text"}, Hash: utils.HashBookmark(first)})
+	store.Set("second", state.Entry{PageID: "existing-page", BlockIDs: []string{"second-text"}, Hash: utils.HashBookmark(second)})
+	store.SetChapter("existing-page", first.ContentID, "ch1-heading")
+	store.SetChapter("existing-page", second.ContentID, "ch2-heading")
+
+	service, mockBlockClient := existingPageService(store)
+	service.WithFullSync(true)
+
+	pageClient := new(MockPageClient)
+	pageClient.On("Get", mock.Anything, notionapi.PageID("existing-page")).Return(&notionapi.Page{ID: "existing-page"}, nil)
+	service.WithPageClient(pageClient)
+
+	heading := func(id string, title string) notionapi.Block {
+		return &notionapi.Heading2Block{
+			BasicBlock: notionapi.BasicBlock{ID: notionapi.BlockID(id), Type: notionapi.BlockTypeHeading2},
+			Heading2:   notionapi.Heading{RichText: []notionapi.RichText{{PlainText: title}}},
+		}
+	}
+
+	// The user typed a heading with the title of the second chapter above the synced one
+	mockBlockClient.On("GetChildren", mock.Anything, notionapi.BlockID("existing-page"), mock.Anything).Return(&notionapi.GetChildrenResponse{
+		Results: []notionapi.Block{
+			heading("ch1-heading", "Chapter One"),
+			syncedQuoteBlock("first-text", PropHighlightedText, "Highlight first"),
+			heading("user-heading", "Chapter Two"),
+			heading("ch2-heading", "Chapter Two"),
+			syncedQuoteBlock("second-text", PropHighlightedText, "Highlight second"),
+		},
+	}, nil)
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{first, second})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+	mockBlockClient.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	mockBlockClient.AssertNotCalled(t, "AppendChildren", mock.Anything, mock.Anything, mock.Anything)
+
+	assert.Equal(t, map[string]string{
+		first.ContentID:  "ch1-heading",
+		second.ContentID: "ch2-heading",
+	}, store.PageChapters("existing-page"), "Only the synced headings should be tracked")
+}
+
+func TestCreateBookPageNewestFirst(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(newCreatedPageBlockClient())
+	service.WithSortOrder(kobo.OrderCreatedDesc)
+
+	older := chapterBookmark("older", 2, "Chapter Two", "span#kobo\\.1\\.1")
+	newer := chapterBookmark("newer", 1, "Chapter One", "span#kobo\\.1\\.1")
+	newer.DateCreated = "2023-02-01T12:00:00Z"
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{}, nil)
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "new-page"}, nil)
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{older, newer})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	// Dates mix chapters, so no headings are written
+	req := mockPageClient.Calls[0].Arguments.Get(1).(*notionapi.PageCreateRequest)
+	assert.Len(t, req.Children, 2)
+	assert.Equal(t, "Highlight newer", req.Children[0].(*notionapi.QuoteBlock).Quote.RichText[2].Text.Content)
+	assert.Equal(t, "Highlight older", req.Children[1].(*notionapi.QuoteBlock).Quote.RichText[2].Text.Content)
+}
+
+// existingPageService returns a service whose database holds the page of the test volume
+func existingPageService(store *state.Store) (*notion.NotionService, *MockBlockClient) {
+	mockDBClient := new(MockDatabaseClient)
+	mockBlockClient := &MockBlockClient{}
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(new(MockPageClient))
+	service.WithBlockClient(mockBlockClient)
+	service.WithStateStore(store)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{
+			{
+				ID: "existing-page",
+				Properties: notionapi.Properties{
+					PropBookTitle: &notionapi.TitleProperty{
+						Title: []notionapi.RichText{{PlainText: "test-volume-id"}},
+					},
+				},
+			},
+		},
+	}, nil)
+
+	return service, mockBlockClient
+}
+
+func TestUpdateBookPageInsertsInOrder(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	first := chapterBookmark("first", 1, "", "span#kobo\\.1\\.1")
+	middle := chapterBookmark("middle", 1, "", "span#kobo\\.2\\.1")
+	last := chapterBookmark("last", 1, "", "span#kobo\\.3\\.1")
+
+	store := state.New()
+	store.Set("first", state.Entry{PageID: "existing-page", BlockIDs: []string{"first-text"}, Hash: utils.HashBookmark(first)})
+	store.Set("last", state.Entry{PageID: "existing-page", BlockIDs: []string{"last-text"}, Hash: utils.HashBookmark(last)})
+
+	service, mockBlockClient := existingPageService(store)
+	mockBlockClient.On("AppendChildren", mock.Anything, notionapi.BlockID("existing-page"), mock.MatchedBy(func(req *notionapi.AppendBlockChildrenRequest) bool {
+		return req.After == "first-text" && len(req.Children) == 1
+	})).Return(&notionapi.AppendBlockChildrenResponse{
+		Results: []notionapi.Block{syncedQuoteBlock("middle-text", PropHighlightedText, "Highlight middle")},
+	}, nil)
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{last, middle, first})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+	mockBlockClient.AssertExpectations(t)
+
+	entry, _ := store.Get("middle")
+	assert.Equal(t, []string{"middle-text"}, entry.BlockIDs)
+}
+
+func TestUpdateBookPageInsertsAtTop(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	older := chapterBookmark("older", 1, "", "span#kobo\\.1\\.1")
+	newer := chapterBookmark("newer", 1, "", "span#kobo\\.2\\.1")
+	newer.DateCreated = "2023-02-01T12:00:00Z"
+
+	store := state.New()
+	store.Set("older", state.Entry{PageID: "existing-page", BlockIDs: []string{"older-text"}, Hash: utils.HashBookmark(older)})
+
+	service, mockBlockClient := existingPageService(store)
+	service.WithSortOrder(kobo.OrderCreatedDesc)
+
+	// Nothing can be inserted before a block, the new highlight goes after the user block preceding the synced ones
+	mockBlockClient.On("GetChildren", mock.Anything, notionapi.BlockID("existing-page"), mock.Anything).Return(&notionapi.GetChildrenResponse{
+		Results: []notionapi.Block{
+			&notionapi.ParagraphBlock{BasicBlock: notionapi.BasicBlock{ID: "user-intro", Type: notionapi.BlockTypeParagraph}},
+			syncedQuoteBlock("older-text", PropHighlightedText, "Highlight older"),
+		},
+	}, nil)
+	mockBlockClient.On("AppendChildren", mock.Anything, notionapi.BlockID("existing-page"), mock.MatchedBy(func(req *notionapi.AppendBlockChildrenRequest) bool {
+		return req.After == "user-intro" && len(req.Children) == 1 &&
+			req.Children[0].(*notionapi.QuoteBlock).Quote.RichText[2].Text.Content == "Highlight newer"
+	})).Return(&notionapi.AppendBlockChildrenResponse{
+		Results: []notionapi.Block{syncedQuoteBlock("newer-text", PropHighlightedText, "Highlight newer")},
+	}, nil)
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{newer, older})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+	mockBlockClient.AssertExpectations(t)
+	mockBlockClient.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+
+	entry, _ := store.Get("older")
+	assert.Equal(t, []string{"older-text"}, entry.BlockIDs, "The synced highlight should keep its block")
+	entry, _ = store.Get("newer")
+	assert.Equal(t, []string{"newer-text"}, entry.BlockIDs)
+}
+
+func TestUpdateBookPageAppendsWithoutLeadingBlock(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	older := chapterBookmark("older", 1, "", "span#kobo\\.1\\.1")
+	newer := chapterBookmark("newer", 1, "", "span#kobo\\.2\\.1")
+	newer.DateCreated = "2023-02-01T12:00:00Z"
+
+	store := state.New()
+	store.Set("older", state.Entry{PageID: "existing-page", BlockIDs: []string{"older-text"}, Hash: utils.HashBookmark(older)})
+
+	service, mockBlockClient := existingPageService(store)
+	service.WithSortOrder(kobo.OrderCreatedDesc)
+
+	// The synced highlight is the first block, the new one is appended out of order
+	mockBlockClient.On("GetChildren", mock.Anything, notionapi.BlockID("existing-page"), mock.Anything).Return(&notionapi.GetChildrenResponse{
+		Results: []notionapi.Block{syncedQuoteBlock("older-text", PropHighlightedText, "Highlight older")},
+	}, nil)
+	mockBlockClient.On("AppendChildren", mock.Anything, notionapi.BlockID("existing-page"), mock.MatchedBy(func(req *notionapi.AppendBlockChildrenRequest) bool {
+		return req.After == "" && len(req.Children) == 1
+	})).Return(&notionapi.AppendBlockChildrenResponse{
+		Results: []notionapi.Block{syncedQuoteBlock("newer-text", PropHighlightedText, "Highlight newer")},
+	}, nil)
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{newer, older})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+	mockBlockClient.AssertExpectations(t)
+	mockBlockClient.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+
+	entry, _ := store.Get("older")
+	assert.Equal(t, []string{"older-text"}, entry.BlockIDs, "The synced highlight should keep its block")
+}
+
+func TestUpdateBookPageAddsNoteInPlace(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	annotated := chapterBookmark("annotated", 1, "", "span#kobo\\.1\\.1")
+	annotated.Annotation = "A new note"
+
+	store := state.New()
+	store.Set("annotated", state.Entry{PageID: "existing-page", BlockIDs: []string{"annotated-text"}, Hash: "before-the-note"})
+
+	service, mockBlockClient := existingPageService(store)
+	mockBlockClient.On("Update", mock.Anything, notionapi.BlockID("annotated-text"), mock.Anything).Return(syncedQuoteBlock("annotated-text", PropHighlightedText, ""), nil)
+	mockBlockClient.On("GetChildren", mock.Anything, notionapi.BlockID("annotated-text"), mock.Anything).Return(&notionapi.GetChildrenResponse{}, nil)
+	mockBlockClient.On("AppendChildren", mock.Anything, notionapi.BlockID("annotated-text"), mock.MatchedBy(func(req *notionapi.AppendBlockChildrenRequest) bool {
+		return len(req.Children) == 1 && req.Children[0].(*notionapi.QuoteBlock).Quote.RichText[0].Text.Content == PropAnnotation
+	})).Return(&notionapi.AppendBlockChildrenResponse{
+		Results: []notionapi.Block{syncedQuoteBlock("annotated-note", PropAnnotation, "A new note")},
+	}, nil)
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{annotated})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+	mockBlockClient.AssertExpectations(t)
+	mockBlockClient.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+
+	entry, _ := store.Get("annotated")
+	assert.Equal(t, []string{"annotated-text"}, entry.BlockIDs, "The note should be nested in the highlight block")
+	assert.Equal(t, utils.HashBookmark(annotated), entry.Hash)
+}
+
+func TestUpdateBookPageRemovesNoteInPlace(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	highlight := chapterBookmark("highlight", 1, "", "span#kobo\\.1\\.1")
+
+	store := state.New()
+	store.Set("highlight", state.Entry{PageID: "existing-page", BlockIDs: []string{"highlight-text"}, Hash: "with-a-note"})
+
+	service, mockBlockClient := existingPageService(store)
+	highlightText := syncedQuoteBlock("highlight-text", PropHighlightedText, "")
+	highlightText.HasChildren = true
+	mockBlockClient.On("Update", mock.Anything, notionapi.BlockID("highlight-text"), mock.Anything).Return(highlightText, nil)
+	mockBlockClient.On("GetChildren", mock.Anything, notionapi.BlockID("highlight-text"), mock.Anything).Return(&notionapi.GetChildrenResponse{
+		Results: []notionapi.Block{
+			syncedQuoteBlock("highlight-note", PropAnnotation, "An old note"),
+			&notionapi.ParagraphBlock{BasicBlock: notionapi.BasicBlock{ID: "user-comment", Type: notionapi.BlockTypeParagraph}},
+		},
+	}, nil)
+	mockBlockClient.On("Delete", mock.Anything, notionapi.BlockID("highlight-note")).Return(syncedQuoteBlock("highlight-note", PropAnnotation, ""), nil)
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{highlight})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+	mockBlockClient.AssertExpectations(t)
+	mockBlockClient.AssertNotCalled(t, "Delete", mock.Anything, notionapi.BlockID("user-comment"))
+	mockBlockClient.AssertNotCalled(t, "AppendChildren", mock.Anything, mock.Anything, mock.Anything)
+
+	entry, _ := store.Get("highlight")
+	assert.Equal(t, []string{"highlight-text"}, entry.BlockIDs)
+}
+
+func TestUpdateBookPageNestsSeparateNote(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	annotated := chapterBookmark("annotated", 1, "", "span#kobo\\.1\\.1")
+	annotated.Annotation = "An edited note"
+
+	// Pages synced before notes were nested hold the note in its own block
+	store := state.New()
+	store.Set("annotated", state.Entry{PageID: "existing-page", BlockIDs: []string{"annotated-text", "annotated-note"}, Hash: "separate-note"})
+
+	service, mockBlockClient := existingPageService(store)
+	mockBlockClient.On("Update", mock.Anything, notionapi.BlockID("annotated-text"), mock.Anything).Return(syncedQuoteBlock("annotated-text", PropHighlightedText, ""), nil)
+	mockBlockClient.On("GetChildren", mock.Anything, notionapi.BlockID("annotated-text"), mock.Anything).Return(&notionapi.GetChildrenResponse{}, nil)
+	mockBlockClient.On("AppendChildren", mock.Anything, notionapi.BlockID("annotated-text"), mock.Anything).Return(&notionapi.AppendBlockChildrenResponse{
+		Results: []notionapi.Block{syncedQuoteBlock("nested-note", PropAnnotation, "An edited note")},
+	}, nil)
+	mockBlockClient.On("Delete", mock.Anything, notionapi.BlockID("annotated-note")).Return(syncedQuoteBlock("annotated-note", PropAnnotation, ""), nil)
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{annotated})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+	mockBlockClient.AssertExpectations(t)
+
+	entry, _ := store.Get("annotated")
+	assert.Equal(t, []string{"annotated-text"}, entry.BlockIDs)
+}
+
+func TestCreateBookPageCalloutStyle(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	renderer, err := notion.NewBookmarkRenderer(config.BlockStyleCallout)
+	assert.NoError(t, err)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(newCreatedPageBlockClient())
+	service.WithRenderer(renderer)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{}, nil)
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "new-page"}, nil)
+
+	annotated := chapterBookmark("annotated", 1, "", "span#kobo\\.1\\.1")
+	annotated.Annotation = "A note"
+	annotated.Color = "2"
+
+	err = service.AddBookmarks("test-db-id", []kobo.Bookmark{annotated})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	req := mockPageClient.Calls[0].Arguments.Get(1).(*notionapi.PageCreateRequest)
+	assert.Len(t, req.Children, 1, "Bookmark should render as a single block")
+	callout, ok := req.Children[0].(*notionapi.CalloutBlock)
+	assert.True(t, ok, "Bookmark should render as a callout")
+	assert.Equal(t, notionapi.Emoji("🔵"), *callout.Callout.Icon.Emoji)
+	assert.Equal(t, PropHighlightedText, callout.Callout.RichText[0].Text.Content)
+	assert.Len(t, callout.Callout.Children, 1, "Annotation should be nested in the callout")
+}
+
+func TestUpdateBookPageReplacesOtherStyle(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	highlight := chapterBookmark("highlight", 1, "", "span#kobo\\.1\\.1")
+
+	// Unchanged bookmark synced as a quote
+	store := state.New()
+	store.Set("highlight", state.Entry{PageID: "existing-page", BlockIDs: []string{"quoted"}, Hash: utils.HashBookmark(highlight)})
+
+	renderer, err := notion.NewBookmarkRenderer(config.BlockStyleToggle)
+	assert.NoError(t, err)
+
+	service, mockBlockClient := existingPageService(store)
+	service.WithRenderer(renderer)
+	mockBlockClient.On("AppendChildren", mock.Anything, notionapi.BlockID("existing-page"), mock.MatchedBy(func(req *notionapi.AppendBlockChildrenRequest) bool {
+		_, ok := req.Children[0].(*notionapi.ToggleBlock)
+		return len(req.Children) == 1 && ok
+	})).Return(&notionapi.AppendBlockChildrenResponse{
+		Results: []notionapi.Block{&notionapi.ToggleBlock{BasicBlock: notionapi.BasicBlock{ID: "toggled", Type: notionapi.BlockTypeToggle}}},
+	}, nil)
+	mockBlockClient.On("Delete", mock.Anything, notionapi.BlockID("quoted")).Return(syncedQuoteBlock("quoted", PropHighlightedText, ""), nil)
+
+	err = service.AddBookmarks("test-db-id", []kobo.Bookmark{highlight})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+	mockBlockClient.AssertExpectations(t)
+	mockBlockClient.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+
+	entry, _ := store.Get("highlight")
+	assert.Equal(t, []string{"toggled"}, entry.BlockIDs)
+	assert.Equal(t, config.BlockStyleToggle, entry.Style)
+}
+
+func TestAddBookmarksWritesColorCategories(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	properties, err := config.ParseProperties("colors=Colours")
+	assert.NoError(t, err)
+	colorNames, err := config.ParseColorNames("yellow=Quote,blue=Idea")
+	assert.NoError(t, err)
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(newCreatedPageBlockClient())
+	service.WithProperties(properties)
+	service.WithColorNames(colorNames)
+
+	bookmarks := []kobo.Bookmark{
+		{BookmarkID: "bm1", VolumeID: "vol1", Text: "An idea", Color: "2", DateCreated: "2023-01-01T12:00:00Z"},
+		{BookmarkID: "bm2", VolumeID: "vol1", Text: "A quote", Color: "0", DateCreated: "2023-01-02T12:00:00Z"},
+		{BookmarkID: "bm3", VolumeID: "vol1", Text: "Another idea", Color: "2", DateCreated: "2023-01-03T12:00:00Z"},
+	}
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{}, nil)
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "new-page"}, nil)
+
+	err = service.AddBookmarks("test-db-id", bookmarks)
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	req := mockPageClient.Calls[0].Arguments.Get(1).(*notionapi.PageCreateRequest)
+
+	colorsProp, ok := req.Properties["Colours"].(notionapi.MultiSelectProperty)
+	assert.True(t, ok, "Colours should be a MultiSelectProperty")
+	assert.Equal(t, []notionapi.Option{{Name: "Quote"}, {Name: "Idea"}}, colorsProp.MultiSelect)
+
+	// The highlighted text is shown on the background of its colour, the label keeps its tint
+	richText := req.Children[0].(*notionapi.QuoteBlock).Quote.RichText
+	assert.Equal(t, notionapi.ColorBlue, richText[0].Annotations.Color)
+	assert.Equal(t, notionapi.ColorBlueBackground, richText[2].Annotations.Color)
+}
+
+func TestCreateBookPageDogEarSection(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(newCreatedPageBlockClient())
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{}, nil)
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "new-page"}, nil)
+
+	dogEar := chapterBookmark("dogear", 1, "Chapter One", "")
+	dogEar.Text = ""
+	dogEar.Type = kobo.TypeDogEar
+	dogEar.ChapterProgress = 0.25
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{dogEar, chapterBookmark("highlight", 2, "", "span#kobo\\.1\\.1")})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+
+	req := mockPageClient.Calls[0].Arguments.Get(1).(*notionapi.PageCreateRequest)
+	assert.Len(t, req.Children, 3, "Dog-ears should follow the highlights under their own heading")
+	assert.Equal(t, "Highlight highlight", req.Children[0].(*notionapi.QuoteBlock).Quote.RichText[2].Text.Content)
+	assert.Equal(t, "Bookmarked locations", req.Children[1].(*notionapi.Heading2Block).Heading2.RichText[0].Text.Content)
+
+	location := req.Children[2].(*notionapi.QuoteBlock).Quote.RichText
+	assert.Equal(t, "Location", location[0].Text.Content)
+	assert.Equal(t, "Chapter One (25%)", location[2].Text.Content)
+}
+
+func TestUpdateBookPageReadingProgress(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	properties, err := config.ParseProperties("progress=Progress,read_status=Status,time_spent=Minutes,last_read=Last Read,finished=Finished")
+	assert.NoError(t, err)
+
+	bookmark := kobo.Bookmark{
+		BookmarkID:   "synced",
+		VolumeID:     "test-volume-id",
+		Text:         "A synced highlight",
+		DateCreated:  "2023-01-01T12:00:00Z",
+		DateModified: "2023-01-01T12:00:00Z",
+	}
+
+	store := state.New()
+	store.Watermark, _ = utils.ParseKoboBookmarkDate("2023-01-02T12:00:00Z")
+	store.Set("synced", state.Entry{PageID: "existing-page", BlockIDs: []string{"synced-text"}, Hash: utils.HashBookmark(bookmark)})
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+	mockBlockClient := &MockBlockClient{}
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(mockBlockClient)
+	service.WithStateStore(store)
+	service.WithProperties(properties)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{
+			{
+				ID: "existing-page",
+				Properties: notionapi.Properties{
+					PropBookTitle: &notionapi.TitleProperty{
+						Title: []notionapi.RichText{{PlainText: "test-volume-id"}},
+					},
+				},
+			},
+		},
+	}, nil)
+
+	bookmark.Book.Reading = &kobo.ReadingStats{PercentRead: 45, ReadStatus: kobo.ReadStatusReading, TimeSpent: 90 * time.Minute, LastRead: "2023-03-01T20:00:00Z"}
+	mockPageClient.On("Update", mock.Anything, notionapi.PageID("existing-page"), mock.MatchedBy(func(req *notionapi.PageUpdateRequest) bool {
+		progress, _ := req.Properties["Progress"].(notionapi.NumberProperty)
+		status, _ := req.Properties["Status"].(notionapi.SelectProperty)
+		minutes, _ := req.Properties["Minutes"].(notionapi.NumberProperty)
+		_, finished := req.Properties["Finished"]
+		return progress.Number == 45 && status.Select.Name == "Reading" && minutes.Number == 90 && !finished
+	})).Return(&notionapi.Page{ID: "existing-page"}, nil).Once()
+
+	err = service.AddBookmarks("test-db-id", []kobo.Bookmark{bookmark})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+	mockPageClient.AssertExpectations(t)
+
+	// Finishing the book updates the page although no highlight changed
+	bookmark.Book.Reading = &kobo.ReadingStats{PercentRead: 100, ReadStatus: kobo.ReadStatusFinished, TimeSpent: 2 * time.Hour, LastRead: "2023-03-05T21:00:00Z"}
+	mockPageClient.On("Update", mock.Anything, notionapi.PageID("existing-page"), mock.MatchedBy(func(req *notionapi.PageUpdateRequest) bool {
+		status, _ := req.Properties["Status"].(notionapi.SelectProperty)
+		finished, ok := req.Properties["Finished"].(notionapi.DateProperty)
+		return ok && status.Select.Name == "Finished" && time.Time(*finished.Date.Start).Equal(time.Date(2023, 3, 5, 21, 0, 0, 0, time.UTC))
+	})).Return(&notionapi.Page{ID: "existing-page"}, nil).Once()
+
+	err = service.AddBookmarks("test-db-id", []kobo.Bookmark{bookmark})
+	assert.NoError(t, err, "AddBookmarks should not return an error")
+	mockPageClient.AssertExpectations(t)
+	mockBlockClient.AssertNotCalled(t, "GetChildren", mock.Anything, mock.Anything, mock.Anything)
+
+	// Unchanged progress skips the book
+	plan, err := service.PlanBookmarks("test-db-id", []kobo.Bookmark{bookmark})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, plan.SkippedBooks)
+}
+
+func TestAddBookmarksMirrorsLibrary(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	properties, err := config.ParseProperties("read_status=Status")
+	assert.NoError(t, err)
+
+	store := state.New()
+	store.Watermark, _ = utils.ParseKoboBookmarkDate("2023-01-02T12:00:00Z")
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+	mockBlockClient := &MockBlockClient{}
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(mockBlockClient)
+	service.WithStateStore(store)
+	service.WithProperties(properties)
+	service.WithLibrary([]kobo.Book{
+		{VolumeID: "vol-reading", Title: "Reading Book", Reading: &kobo.ReadingStats{ReadStatus: kobo.ReadStatusReading}},
+		{VolumeID: "vol-unread", Title: "Unread Book"},
+		{VolumeID: "vol-finished", Title: "Finished Book", Reading: &kobo.ReadingStats{ReadStatus: kobo.ReadStatusFinished}},
+	}, kobo.BookFilter{Statuses: []string{config.ReadStatusReading}})
+
+	// The finished book lost its last highlight, the removed book left the device
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{bookPage("finished-page", "Finished Book"), bookPage("removed-page", "Removed Book")},
+	}, nil)
+	mockPageClient.On("Get", mock.Anything, notionapi.PageID("finished-page")).Return(&notionapi.Page{ID: "finished-page"}, nil)
+	mockBlockClient.On("GetChildren", mock.Anything, notionapi.BlockID("finished-page"), mock.Anything).Return(&notionapi.GetChildrenResponse{}, nil)
+
+	plan, err := service.PlanBookmarks("test-db-id", nil)
+	assert.NoError(t, err)
+
+	actions := make(map[string]notion.PageAction)
+	for _, page := range plan.Pages {
+		actions[page.Book] = page.Action
+	}
+	assert.Equal(t, map[string]notion.PageAction{
+		"Reading Book":  notion.PageCreate,
+		"Finished Book": notion.PageUpdate,
+		"Removed Book":  notion.PageArchive,
+	}, actions, "Only the book matching the filter should be created, and the finished one kept")
+
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "new-page"}, nil)
+	mockPageClient.On("Update", mock.Anything, mock.Anything, mock.Anything).Return(&notionapi.Page{}, nil)
+
+	err = service.ApplyPlan(plan)
+	assert.NoError(t, err)
+
+	// The kept page has its status updated
+	mockPageClient.AssertCalled(t, "Update", mock.Anything, notionapi.PageID("finished-page"), mock.MatchedBy(func(req *notionapi.PageUpdateRequest) bool {
+		status, ok := req.Properties["Status"].(notionapi.SelectProperty)
+		return ok && status.Select.Name == "Finished" && !req.Archived
+	}))
+
+	var req *notionapi.PageCreateRequest
+	for _, call := range mockPageClient.Calls {
+		if call.Method == "Create" {
+			req = call.Arguments.Get(1).(*notionapi.PageCreateRequest)
+		}
+	}
+	assert.NotNil(t, req, "A page should be created for the book being read")
+	assert.Empty(t, req.Children, "A book without highlights should get an empty page")
+	status, ok := req.Properties["Status"].(notionapi.SelectProperty)
+	assert.True(t, ok, "Status should be a SelectProperty")
+	assert.Equal(t, "Reading", status.Select.Name)
+	_, hasDate := req.Properties[PropDateCreated]
+	assert.False(t, hasDate, "A book without highlights has no creation date")
+}
+
+func TestPlanBookmarksRemovalLimit(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+	mockBlockClient := &MockBlockClient{}
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(mockBlockClient)
+	service.WithDeletePolicy(config.DeletePolicyArchive, 1, 50)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{bookPage("page-1", "Book One"), bookPage("page-2", "Book Two"), bookPage("page-3", "Book Three")},
+	}, nil)
+
+	// An empty Kobo database would archive every page
+	_, err := service.PlanBookmarks("test-db-id", nil)
+	var limit *notion.RemovalLimitError
+	assert.ErrorAs(t, err, &limit)
+	assert.Equal(t, 3, limit.Removed)
+
+	// Removing one book of three stays under the limit
+	mockPageClient.On("Get", mock.Anything, mock.Anything).Return(&notionapi.Page{}, nil)
+	mockBlockClient.On("GetChildren", mock.Anything, mock.Anything, mock.Anything).Return(&notionapi.GetChildrenResponse{}, nil)
+	plan, err := service.PlanBookmarks("test-db-id", []kobo.Bookmark{
+		{BookmarkID: "bm1", VolumeID: "vol1", Text: "Kept", Book: kobo.Book{Title: "Book One"}, DateCreated: "2023-01-01T12:00:00Z"},
+		{BookmarkID: "bm2", VolumeID: "vol2", Text: "Kept", Book: kobo.Book{Title: "Book Two"}, DateCreated: "2023-01-01T12:00:00Z"},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, plan.String(), `- archive "Book Three"`)
+}
+
+func TestAddBookmarksArchivesAfterMissingSyncs(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	store := state.New()
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(&MockBlockClient{})
+	service.WithStateStore(store)
+	service.WithDeletePolicy(config.DeletePolicyArchive, 2, 100)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{bookPage("removed-page", "Removed Book")},
+	}, nil)
+
+	// The first sync missing the book only counts it
+	plan, err := service.PlanBookmarks("test-db-id", nil)
+	assert.NoError(t, err)
+	assert.Contains(t, plan.String(), `? keep "Removed Book", missing from the Kobo for 1 syncs`)
+	assert.NoError(t, service.ApplyPlan(plan))
+	mockPageClient.AssertNotCalled(t, "Update", mock.Anything, mock.Anything, mock.Anything)
+	assert.Equal(t, 1, store.MissingSyncs("removed-page"))
+
+	// The second one archives its page
+	mockPageClient.On("Update", mock.Anything, notionapi.PageID("removed-page"), mock.MatchedBy(func(req *notionapi.PageUpdateRequest) bool {
+		return req.Archived
+	})).Return(&notionapi.Page{ID: "removed-page"}, nil).Once()
+
+	err = service.AddBookmarks("test-db-id", nil)
+	assert.NoError(t, err)
+	mockPageClient.AssertExpectations(t)
+	assert.Equal(t, 0, store.MissingSyncs("removed-page"))
+}
+
+func TestAddBookmarksMarksRemovedBooks(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	properties, err := config.ParseProperties("removed=Removed")
+	assert.NoError(t, err)
+
+	store := state.New()
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(&MockBlockClient{})
+	service.WithStateStore(store)
+	service.WithProperties(properties)
+	service.WithDeletePolicy(config.DeletePolicyMark, 1, 100)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{bookPage("removed-page", "Removed Book")},
+	}, nil)
+	mockPageClient.On("Update", mock.Anything, notionapi.PageID("removed-page"), mock.MatchedBy(func(req *notionapi.PageUpdateRequest) bool {
+		title, _ := req.Properties[PropBookTitle].(notionapi.TitleProperty)
+		removed, ok := req.Properties["Removed"].(notionapi.DateProperty)
+		return !req.Archived && len(title.Title) == 1 && title.Title[0].Annotations.Strikethrough && ok && removed.Date != nil
+	})).Return(&notionapi.Page{ID: "removed-page"}, nil).Once()
+
+	err = service.AddBookmarks("test-db-id", nil)
+	assert.NoError(t, err)
+	mockPageClient.AssertExpectations(t)
+
+	// A page is only marked once
+	plan, err := service.PlanBookmarks("test-db-id", nil)
+	assert.NoError(t, err)
+	assert.Empty(t, plan.Pages)
+
+	// The book coming back clears the mark
+	mockPageClient.On("Update", mock.Anything, notionapi.PageID("removed-page"), mock.MatchedBy(func(req *notionapi.PageUpdateRequest) bool {
+		title, _ := req.Properties[PropBookTitle].(notionapi.TitleProperty)
+		removed, ok := req.Properties["Removed"].(notionapi.DateProperty)
+		return len(title.Title) == 1 && title.Title[0].Annotations == nil && ok && removed.Date == nil
+	})).Return(&notionapi.Page{ID: "removed-page"}, nil).Once()
+	mockPageClient.On("Get", mock.Anything, notionapi.PageID("removed-page")).Return(&notionapi.Page{ID: "removed-page"}, nil)
+	blockClient := &MockBlockClient{}
+	blockClient.On("GetChildren", mock.Anything, notionapi.BlockID("removed-page"), mock.Anything).Return(&notionapi.GetChildrenResponse{}, nil)
+	blockClient.On("AppendChildren", mock.Anything, notionapi.BlockID("removed-page"), mock.Anything).Return(&notionapi.AppendBlockChildrenResponse{}, nil)
+	service.WithBlockClient(blockClient)
+
+	err = service.AddBookmarks("test-db-id", []kobo.Bookmark{
+		{BookmarkID: "bm1", VolumeID: "vol1", Text: "Back again", Book: kobo.Book{Title: "Removed Book"}, DateCreated: "2023-01-01T12:00:00Z"},
+	})
+	assert.NoError(t, err)
+	mockPageClient.AssertExpectations(t)
+	assert.Equal(t, 0, store.MissingSyncs("removed-page"))
+}
+
+func TestUpdateBookPageMarksRemovedHighlight(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	kept := kobo.Bookmark{
+		BookmarkID:   "kept",
+		VolumeID:     "test-volume-id",
+		Text:         "A kept highlight",
+		DateCreated:  "2023-01-01T12:00:00Z",
+		DateModified: "2023-01-01T12:00:00Z",
+	}
+
+	store := state.New()
+	store.Watermark, _ = utils.ParseKoboBookmarkDate("2023-01-02T12:00:00Z")
+	store.Set("kept", state.Entry{PageID: "existing-page", BlockIDs: []string{"kept-text"}, Hash: utils.HashBookmark(kept)})
+	store.Set("removed", state.Entry{PageID: "existing-page", BlockIDs: []string{"removed-text"}, Hash: "old-hash"})
+
+	mockDBClient := new(MockDatabaseClient)
+	mockBlockClient := &MockBlockClient{}
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(new(MockPageClient))
+	service.WithBlockClient(mockBlockClient)
+	service.WithStateStore(store)
+	service.WithDeletePolicy(config.DeletePolicyMark, 1, 100)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{bookPage("existing-page", "test-volume-id")},
+	}, nil)
+	mockBlockClient.On("Get", mock.Anything, notionapi.BlockID("removed-text")).Return(
+		syncedQuoteBlock("removed-text", PropHighlightedText, "A removed highlight"), nil)
+	mockBlockClient.On("Update", mock.Anything, notionapi.BlockID("removed-text"), mock.MatchedBy(func(req *notionapi.BlockUpdateRequest) bool {
+		for _, richText := range req.Quote.RichText {
+			if richText.Annotations == nil || !richText.Annotations.Strikethrough {
+				return false
+			}
+		}
+		return len(req.Quote.RichText) > 0
+	})).Return(syncedQuoteBlock("removed-text", PropHighlightedText, "A removed highlight"), nil).Once()
+
+	err := service.AddBookmarks("test-db-id", []kobo.Bookmark{kept})
+	assert.NoError(t, err)
+	mockBlockClient.AssertExpectations(t)
+	mockBlockClient.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+
+	entry, ok := store.Get("removed")
+	assert.True(t, ok, "A marked highlight should still be tracked")
+	assert.True(t, entry.Removed)
+
+	// Marked highlights are not marked again
+	plan, err := service.PlanBookmarks("test-db-id", []kobo.Bookmark{kept})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, plan.SkippedBooks)
+}
+
+func TestAddBookmarksWritesShelves(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	properties, err := config.ParseProperties("shelves=Shelves")
+	assert.NoError(t, err)
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(newCreatedPageBlockClient())
+	service.WithStateStore(state.New())
+	service.WithProperties(properties)
+
+	bookmark := kobo.Bookmark{
+		BookmarkID:  "bm1",
+		VolumeID:    "vol1",
+		Text:        "A highlight",
+		DateCreated: "2023-01-01T12:00:00Z",
+		Book:        kobo.Book{Title: "Shelved Book", Shelves: []string{"Book Club, 2026", "Work"}},
+	}
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{}, nil).Once()
+	mockPageClient.On("Create", mock.Anything, mock.Anything).Return(&notionapi.Page{ID: "new-page"}, nil)
+
+	err = service.AddBookmarks("test-db-id", []kobo.Bookmark{bookmark})
+	assert.NoError(t, err)
+
+	// Shelf names are options on their own, even with commas
+	req := mockPageClient.Calls[0].Arguments.Get(1).(*notionapi.PageCreateRequest)
+	shelvesProp, ok := req.Properties["Shelves"].(notionapi.MultiSelectProperty)
+	assert.True(t, ok, "Shelves should be a MultiSelectProperty")
+	assert.Equal(t, []notionapi.Option{{Name: "Book Club  2026"}, {Name: "Work"}}, shelvesProp.MultiSelect)
+
+	// Taking the book off its shelves clears the property
+	blockClient := &MockBlockClient{}
+	blockClient.On("GetChildren", mock.Anything, notionapi.BlockID("new-page"), mock.Anything).Return(&notionapi.GetChildrenResponse{}, nil)
+	blockClient.On("AppendChildren", mock.Anything, notionapi.BlockID("new-page"), mock.Anything).Return(&notionapi.AppendBlockChildrenResponse{}, nil)
+	service.WithBlockClient(blockClient)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{bookPage("new-page", "Shelved Book")},
+	}, nil)
+	mockPageClient.On("Get", mock.Anything, notionapi.PageID("new-page")).Return(&notionapi.Page{ID: "new-page"}, nil)
+	mockPageClient.On("Update", mock.Anything, notionapi.PageID("new-page"), mock.MatchedBy(func(req *notionapi.PageUpdateRequest) bool {
+		shelves, ok := req.Properties["Shelves"].(notionapi.MultiSelectProperty)
+		return ok && shelves.MultiSelect != nil && len(shelves.MultiSelect) == 0
+	})).Return(&notionapi.Page{ID: "new-page"}, nil).Once()
+
+	bookmark.Book.Shelves = nil
+	err = service.AddBookmarks("test-db-id", []kobo.Bookmark{bookmark})
+	assert.NoError(t, err)
+	mockPageClient.AssertExpectations(t)
+}
+
+func TestPlanBookmarksMarksAdoptedRemovedHighlight(t *testing.T) {
+	setupLogger()
+	defer logger.Close()
+
+	kept := kobo.Bookmark{
+		BookmarkID:   "kept",
+		VolumeID:     "test-volume-id",
+		Text:         "A kept highlight",
+		DateCreated:  "2023-01-01T12:00:00Z",
+		DateModified: "2023-01-01T12:00:00Z",
+	}
+
+	store := state.New()
+	store.Set("kept", state.Entry{PageID: "existing-page", BlockIDs: []string{"kept-text"}, Hash: utils.HashBookmark(kept)})
+	store.Set("removed", state.Entry{PageID: "existing-page", BlockIDs: []string{"removed-text"}, Hash: "old-hash"})
+
+	mockDBClient := new(MockDatabaseClient)
+	mockPageClient := new(MockPageClient)
+	mockBlockClient := &MockBlockClient{}
+
+	service := notion.NewNotionService("test-token")
+	service.WithDatabaseClient(mockDBClient)
+	service.WithPageClient(mockPageClient)
+	service.WithBlockClient(mockBlockClient)
+	service.WithStateStore(store)
+	service.WithFullSync(true)
+	service.WithDeletePolicy(config.DeletePolicyMark, 1, 100)
+
+	mockDBClient.On("Query", mock.Anything, notionapi.DatabaseID("test-db-id"), mock.Anything).Return(&notionapi.DatabaseQueryResponse{
+		Results: []notionapi.Page{bookPage("existing-page", "test-volume-id")},
+	}, nil)
+	mockPageClient.On("Get", mock.Anything, notionapi.PageID("existing-page")).Return(&notionapi.Page{ID: "existing-page"}, nil)
+	mockBlockClient.On("GetChildren", mock.Anything, notionapi.BlockID("existing-page"), mock.Anything).Return(&notionapi.GetChildrenResponse{
+		Results: []notionapi.Block{
+			syncedQuoteBlock("kept-text", PropHighlightedText, "A kept highlight"),
+			syncedQuoteBlock("removed-text", PropHighlightedText, "A removed highlight"),
+		},
+	}, nil)
+
+	// Full syncs adopt the blocks of the page again, the removed highlight matches no bookmark
+	plan, err := service.PlanBookmarks("test-db-id", []kobo.Bookmark{kept})
+	assert.NoError(t, err)
+	assert.Len(t, plan.Pages, 1)
+	assert.Equal(t, []notion.BlockChange{
+		{Action: notion.BlockMark, BookmarkID: "removed", BlockIDs: []string{"removed-text"}},
+	}, plan.Pages[0].Blocks)
+
+	mockBlockClient.On("Get", mock.Anything, notionapi.BlockID("removed-text")).Return(
+		syncedQuoteBlock("removed-text", PropHighlightedText, "A removed highlight"), nil)
+	mockBlockClient.On("Update", mock.Anything, notionapi.BlockID("removed-text"), mock.Anything).Return(
+		syncedQuoteBlock("removed-text", PropHighlightedText, "A removed highlight"), nil).Once()
+
+	assert.NoError(t, service.ApplyPlan(plan))
+	mockBlockClient.AssertExpectations(t)
+	mockBlockClient.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+
+	entry, ok := store.Get("removed")
+	assert.True(t, ok, "Adoption should keep tracking the removed highlight")
+	assert.True(t, entry.Removed)
+}
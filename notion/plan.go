@@ -0,0 +1,311 @@
+package notion
+
+import (
+	"encoding/json"
+	"fmt"
+	"kobo-to-notion/kobo"
+	"kobo-to-notion/logger"
+	"kobo-to-notion/state"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// Plan modes, matching the layout of the database being synced
+const (
+	PlanModeGrouped = "grouped"
+	PlanModeFlat    = "flat"
+)
+
+// PageAction is what a sync does to a page of the database
+type PageAction string
+
+const (
+	PageCreate  PageAction = "create"
+	PageUpdate  PageAction = "update"
+	PageArchive PageAction = "archive"
+	// PageMark strikes through the title of a page whose book was removed from the Kobo
+	PageMark PageAction = "mark"
+	// PageKeep leaves the page of a missing book untouched until it has been missing long enough
+	PageKeep PageAction = "keep"
+)
+
+// BlockAction is what a sync does to the blocks of a bookmark
+type BlockAction string
+
+const (
+	BlockAdd    BlockAction = "add"
+	BlockUpdate BlockAction = "update"
+	BlockDelete BlockAction = "delete"
+	// BlockReplace writes new blocks and deletes the previous ones, for blocks that
+	// cannot be updated in place or have to move to keep the page in order
+	BlockReplace BlockAction = "replace"
+	// BlockMark strikes through the blocks of a bookmark removed from the Kobo
+	BlockMark BlockAction = "mark"
+)
+
+// BlockChange is a change to the blocks synced for a bookmark, or to the heading of a
+// chapter when ChapterID is set. Deletions without either remove synced blocks that no
+// longer match any bookmark.
+type BlockChange struct {
+	Action     BlockAction `json:"action"`
+	BookmarkID string      `json:"bookmark_id,omitempty"`
+	ChapterID  string      `json:"chapter_id,omitempty"`
+	Chapter    string      `json:"chapter,omitempty"`
+	BlockIDs   []string    `json:"block_ids,omitempty"`
+	// After is the block new blocks are inserted after, they are appended to the page when empty
+	After   string `json:"after,omitempty"`
+	Preview string `json:"preview,omitempty"`
+
+	blocks []notionapi.Block
+	hash   string
+}
+
+// PageChange groups the changes made to the page of a book
+type PageChange struct {
+	Action     PageAction `json:"action"`
+	Book       string     `json:"book"`
+	PageID     string     `json:"page_id,omitempty"`
+	RenameFrom string     `json:"rename_from,omitempty"`
+	// MissingSyncs counts the syncs in a row the book was missing from the Kobo, this one included
+	MissingSyncs int `json:"missing_syncs,omitempty"`
+	// PropertiesChanged is set when the page properties are written again
+	PropertiesChanged bool          `json:"properties_changed,omitempty"`
+	Blocks            []BlockChange `json:"blocks,omitempty"`
+
+	book            kobo.Book
+	bookmarks       []kobo.Bookmark
+	adopted         map[string]state.Entry
+	adoptedChapters map[string]string
+	propertiesHash  string
+}
+
+// Plan is the set of changes a sync makes to the database, computed without writing to Notion
+type Plan struct {
+	DatabaseID   string       `json:"database_id"`
+	Mode         string       `json:"mode"`
+	Pages        []PageChange `json:"pages"`
+	SkippedBooks int          `json:"skipped_books"`
+	Errors       []string     `json:"errors,omitempty"`
+
+	bookmarks []kobo.Bookmark
+	// foundPages are the pages whose book is on the Kobo
+	foundPages []string
+	// bookPages are the existing pages matched to each book, keyed by VolumeID
+	bookPages map[string]string
+}
+
+// HasChanges reports whether the page change writes anything to Notion
+func (c PageChange) HasChanges() bool {
+	switch c.Action {
+	case PageUpdate:
+		return c.PropertiesChanged || len(c.Blocks) > 0
+	case PageKeep:
+		return false
+	default:
+		return true
+	}
+}
+
+// JSON renders the plan as indented JSON
+func (p *Plan) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// String renders the plan as human readable text
+func (p *Plan) String() string {
+	var b strings.Builder
+
+	counts := make(map[PageAction]int)
+	unchanged := p.SkippedBooks
+	for _, page := range p.Pages {
+		if !page.HasChanges() {
+			unchanged++
+			continue
+		}
+		counts[page.Action]++
+	}
+
+	fmt.Fprintf(&b, "Sync plan for database %s (%s mode): %d pages to create, %d to update, %d to archive, %d to mark as removed, %d unchanged\n",
+		p.DatabaseID, p.Mode, counts[PageCreate], counts[PageUpdate], counts[PageArchive], counts[PageMark], unchanged)
+
+	for _, page := range p.Pages {
+		if page.Action == PageKeep {
+			fmt.Fprintf(&b, "? keep %q, missing from the Kobo for %d syncs\n", page.Book, page.MissingSyncs)
+			continue
+		}
+		if !page.HasChanges() {
+			continue
+		}
+
+		switch page.Action {
+		case PageCreate:
+			fmt.Fprintf(&b, "+ create %q\n", page.Book)
+		case PageUpdate:
+			fmt.Fprintf(&b, "~ update %q\n", page.Book)
+		case PageArchive:
+			fmt.Fprintf(&b, "- archive %q\n", page.Book)
+		case PageMark:
+			fmt.Fprintf(&b, "x mark %q as removed\n", page.Book)
+		}
+
+		if page.RenameFrom != "" {
+			fmt.Fprintf(&b, "    renamed from %q\n", page.RenameFrom)
+		} else if page.PropertiesChanged {
+			fmt.Fprintf(&b, "    ~ properties\n")
+		}
+
+		for _, block := range page.Blocks {
+			switch {
+			case block.Action == BlockAdd && block.ChapterID != "":
+				fmt.Fprintf(&b, "    + add heading %q\n", block.Chapter)
+			case block.Action == BlockAdd:
+				fmt.Fprintf(&b, "    + add %s: %q\n", block.BookmarkID, block.Preview)
+			case block.Action == BlockUpdate:
+				fmt.Fprintf(&b, "    ~ update %s: %q\n", block.BookmarkID, block.Preview)
+			case block.Action == BlockReplace && block.ChapterID != "":
+				fmt.Fprintf(&b, "    ~ replace heading %q\n", block.Chapter)
+			case block.Action == BlockReplace:
+				fmt.Fprintf(&b, "    ~ replace %s: %q\n", block.BookmarkID, block.Preview)
+			case block.Action == BlockMark:
+				fmt.Fprintf(&b, "    x mark %s as removed (%d blocks)\n", block.BookmarkID, len(block.BlockIDs))
+			case block.ChapterID != "":
+				fmt.Fprintf(&b, "    - delete heading of chapter %s without highlights\n", block.ChapterID)
+			case block.BookmarkID == "":
+				fmt.Fprintf(&b, "    - delete %d blocks matching no bookmark\n", len(block.BlockIDs))
+			default:
+				fmt.Fprintf(&b, "    - delete %s (%d blocks)\n", block.BookmarkID, len(block.BlockIDs))
+			}
+		}
+	}
+
+	for _, err := range p.Errors {
+		fmt.Fprintf(&b, "! %s\n", err)
+	}
+
+	return b.String()
+}
+
+// bookmarkPreview returns the start of a bookmark's text to identify it in a plan
+func bookmarkPreview(bookmark kobo.Bookmark) string {
+	const previewLength = 60
+
+	text := bookmark.Text
+	if text == "" {
+		text = bookmark.Annotation
+	}
+	text = strings.Join(strings.Fields(text), " ")
+
+	runes := []rune(text)
+	if len(runes) > previewLength {
+		return string(runes[:previewLength]) + "…"
+	}
+	return text
+}
+
+// PartialSyncError reports pages that could not be synced while the others were
+type PartialSyncError struct {
+	Failed int
+	Total  int
+}
+
+func (e *PartialSyncError) Error() string {
+	return fmt.Sprintf("%d of %d pages could not be synced and will be retried on the next run", e.Failed, e.Total)
+}
+
+// ApplyPlan writes the planned changes to Notion and records them in the state store.
+// Failing pages are logged and counted, the others are still applied.
+func (s *NotionService) ApplyPlan(plan *Plan) error {
+	failedPages := len(plan.Errors)
+
+	for _, pageID := range plan.foundPages {
+		s.store.SetMissingSyncs(pageID, 0)
+	}
+	for volumeID, pageID := range plan.bookPages {
+		s.store.SetBookPage(volumeID, pageID)
+	}
+
+	for _, change := range plan.Pages {
+		if change.Action == PageKeep {
+			s.store.SetMissingSyncs(change.PageID, change.MissingSyncs)
+			continue
+		}
+
+		if !change.HasChanges() && change.adopted == nil {
+			// Pages synced before their properties were tracked start being tracked now
+			if change.propertiesHash != "" {
+				s.store.SetPageHash(change.PageID, change.propertiesHash)
+			}
+			continue
+		}
+
+		var err error
+		switch change.Action {
+		case PageCreate:
+			logger.Logger.Printf("Processing book: %s\n", change.Book)
+			if plan.Mode == PlanModeFlat {
+				err = s.createBookmarkPage(plan.DatabaseID, change.bookmarks[0])
+			} else {
+				err = s.createBookPageWithBookmarks(plan.DatabaseID, change.book, change.bookmarks)
+			}
+		case PageUpdate:
+			logger.Logger.Printf("Processing book: %s\n", change.Book)
+			err = s.applyBookPage(change)
+		case PageArchive:
+			logger.Logger.Printf("Removing book page for book: %s\n", change.Book)
+			err = s.archiveBookPage(plan.DatabaseID, notionapi.PageID(change.PageID))
+			if err != nil {
+				logger.Logger.Printf("Error removing page for book %s: %v", change.Book, err)
+			}
+			continue
+		case PageMark:
+			logger.Logger.Printf("Marking book page as removed for book: %s\n", change.Book)
+			if err := s.markBookPage(change); err != nil {
+				logger.Logger.Printf("Error marking page for book %s: %v", change.Book, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			logger.Logger.Printf("Error syncing page for book %s: %v", change.Book, err)
+			failedPages++
+			continue
+		}
+
+		logger.Logger.Printf("Successfully processed book: %s\n", change.Book)
+	}
+
+	if plan.SkippedBooks > 0 {
+		logger.Logger.Printf("Skipped %d books without changes since the last sync\n", plan.SkippedBooks)
+	}
+
+	// Failed books must be retried, so the watermark only moves after a clean sync
+	if failedPages == 0 {
+		s.store.LastSync = time.Now()
+		if plan.Mode == PlanModeGrouped {
+			s.advanceWatermark(plan.bookmarks)
+		}
+	}
+
+	if err := s.store.Save(); err != nil {
+		return err
+	}
+
+	logger.Logger.Println(s.RequestSummary())
+	if failedPages > 0 {
+		return &PartialSyncError{Failed: failedPages, Total: len(plan.Pages) + len(plan.Errors)}
+	}
+
+	return nil
+}
+
+// archiveBookPage archives the page of a book removed from the Kobo and forgets its bookmarks
+func (s *NotionService) archiveBookPage(databaseID string, pageID notionapi.PageID) error {
+	if err := s.ArchivePage(databaseID, pageID); err != nil {
+		return err
+	}
+
+	s.store.DeletePage(string(pageID))
+	return nil
+}
@@ -0,0 +1,259 @@
+package notion
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"kobo-to-notion/config"
+	"kobo-to-notion/kobo"
+	"kobo-to-notion/logger"
+	"kobo-to-notion/utils"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// Order in which fields are listed, title first
+var fieldOrder = []string{
+	config.FieldTitle, config.FieldBookName, config.FieldAuthor, config.FieldISBN, config.FieldPublisher,
+	config.FieldSeries, config.FieldLanguage, config.FieldCreated, config.FieldLastHighlight, config.FieldHighlightCount,
+	config.FieldColors, config.FieldShelves, config.FieldProgress, config.FieldReadStatus, config.FieldTimeSpent,
+	config.FieldFirstOpened, config.FieldLastRead, config.FieldFinished, config.FieldRemoved, config.FieldHighlight,
+	config.FieldAnnotation, config.FieldType, config.FieldBookmarkID,
+}
+
+// Fields holding the values of a whole book, written in grouped mode only
+var bookAggregateFields = []string{
+	config.FieldLastHighlight, config.FieldHighlightCount, config.FieldProgress, config.FieldReadStatus,
+	config.FieldTimeSpent, config.FieldFirstOpened, config.FieldLastRead, config.FieldFinished, config.FieldRemoved,
+}
+
+// Fields holding a single highlight, written in flat mode only
+var highlightFields = []string{config.FieldHighlight, config.FieldAnnotation, config.FieldType, config.FieldBookmarkID}
+
+// propertyName returns the database property a field is written to
+func (s *NotionService) propertyName(field string) (string, bool) {
+	mapping, ok := s.properties[field]
+	return mapping.Name, ok
+}
+
+// modeFields returns the mapped fields written in a sync mode, in the order of fieldOrder
+func (s *NotionService) modeFields(mode string) []string {
+	excluded := highlightFields
+	if mode == PlanModeFlat {
+		excluded = bookAggregateFields
+	}
+
+	var fields []string
+	for _, field := range fieldOrder {
+		if _, ok := s.properties[field]; ok && !slices.Contains(excluded, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// bookFieldValues returns the values of the fields of a book page, books mirrored from the
+// library may have no bookmarks
+func bookFieldValues(book kobo.Book, bookmarks []kobo.Bookmark, colorNames map[string]string) map[string]any {
+	values := metadataFieldValues(book)
+	values[config.FieldColors] = colorCategories(bookmarks, colorNames)
+
+	// Dog-ears mark pages, they are not highlights
+	highlights, _ := kobo.SplitDogEars(bookmarks)
+
+	var lastHighlight time.Time
+	for _, bookmark := range highlights {
+		if date, err := utils.ParseKoboBookmarkDate(bookmark.DateCreated); err == nil && date.After(lastHighlight) {
+			lastHighlight = date
+		}
+	}
+	if !lastHighlight.IsZero() {
+		values[config.FieldLastHighlight] = lastHighlight
+	}
+	values[config.FieldHighlightCount] = len(highlights)
+
+	// Books on the Kobo clear the date a page was marked as removed
+	values[config.FieldRemoved] = nil
+
+	if reading := book.Reading; reading != nil {
+		readingFieldValues(values, *reading)
+	}
+
+	return values
+}
+
+// readingFieldValues adds the reading progress of a book to the values of its page.
+// Time spent is counted in minutes and dates not recorded by the Kobo are left out.
+func readingFieldValues(values map[string]any, reading kobo.ReadingStats) {
+	values[config.FieldProgress] = reading.PercentRead
+	values[config.FieldReadStatus] = reading.Status()
+	values[config.FieldTimeSpent] = int(reading.TimeSpent.Minutes())
+
+	dates := map[string]string{
+		config.FieldFirstOpened: reading.FirstOpened,
+		config.FieldLastRead:    reading.LastRead,
+		config.FieldFinished:    reading.Finished(),
+	}
+	for field, value := range dates {
+		if date, err := utils.ParseKoboBookmarkDate(value); err == nil {
+			values[field] = date
+		}
+	}
+}
+
+// bookmarkFieldValues returns the values of the fields of a single highlight row
+func bookmarkFieldValues(bookmark kobo.Bookmark, colorNames map[string]string) map[string]any {
+	values := metadataFieldValues(bookOf(bookmark))
+	values[config.FieldColors] = colorCategories([]kobo.Bookmark{bookmark}, colorNames)
+	values[config.FieldHighlight] = bookmark.Text
+	values[config.FieldAnnotation] = bookmark.Annotation
+	values[config.FieldType] = bookmark.Type
+	values[config.FieldBookmarkID] = bookmark.BookmarkID
+	return values
+}
+
+// colorCategories returns the comma separated names of the highlight colours used by bookmarks,
+// in colour order. Colours without a name are left out.
+func colorCategories(bookmarks []kobo.Bookmark, colorNames map[string]string) string {
+	var colors []string
+	for _, bookmark := range bookmarks {
+		colors = append(colors, bookmark.Color)
+	}
+	return strings.Join(config.ColorCategories(colors, colorNames), ", ")
+}
+
+// bookOf returns the book of a bookmark. Its volume ID is always set, bookmarks of
+// sideloaded files may have no content row.
+func bookOf(bookmark kobo.Bookmark) kobo.Book {
+	book := bookmark.Book
+	book.VolumeID = bookmark.VolumeID
+	return book
+}
+
+// metadataFieldValues returns the values of the fields describing a book
+func metadataFieldValues(book kobo.Book) map[string]any {
+	bookName := utils.GetBookTitle(book)
+	return map[string]any{
+		config.FieldTitle:     bookName,
+		config.FieldBookName:  bookName,
+		config.FieldAuthor:    book.Author,
+		config.FieldISBN:      book.ISBN,
+		config.FieldPublisher: book.Publisher,
+		config.FieldSeries:    book.Series,
+		config.FieldLanguage:  book.Language,
+		config.FieldShelves:   book.Shelves,
+	}
+}
+
+// buildProperties converts field values into the properties of a page in a sync mode.
+// Empty text values are left out, sideloaded books often lack metadata.
+func (s *NotionService) buildProperties(values map[string]any, mode string) notionapi.Properties {
+	properties := notionapi.Properties{}
+
+	for _, field := range s.modeFields(mode) {
+		value, ok := values[field]
+		if !ok {
+			continue
+		}
+
+		mapping := s.properties[field]
+		if property, ok := propertyValue(mapping.Type, value); ok {
+			properties[mapping.Name] = property
+		}
+	}
+
+	return properties
+}
+
+// propertyValue converts a field value into a property of the given type, nil clears a date
+// or text property and an empty list a multi-select
+func propertyValue(propertyType string, value any) (notionapi.Property, bool) {
+	switch v := value.(type) {
+	case []string:
+		if propertyType == config.PropertyTypeMultiSelect {
+			options := make([]notionapi.Option, 0, len(v))
+			for _, name := range v {
+				options = append(options, notionapi.Option{Name: selectOptionName(name)})
+			}
+			return notionapi.MultiSelectProperty{MultiSelect: options}, true
+		}
+		value = strings.Join(v, ", ")
+	case nil:
+		if propertyType == config.PropertyTypeDate {
+			return notionapi.DateProperty{}, true
+		}
+		return notionapi.RichTextProperty{RichText: []notionapi.RichText{}}, true
+	case time.Time:
+		if propertyType == config.PropertyTypeDate {
+			date := notionapi.Date(v)
+			return notionapi.DateProperty{
+				Date: &notionapi.DateObject{
+					Start: &date,
+				},
+			}, true
+		}
+		value = v.Format(time.RFC3339)
+	case int:
+		if propertyType == config.PropertyTypeNumber {
+			return notionapi.NumberProperty{Number: float64(v)}, true
+		}
+		value = strconv.Itoa(v)
+	}
+
+	text, _ := value.(string)
+	if text == "" {
+		return nil, false
+	}
+
+	switch propertyType {
+	case config.PropertyTypeTitle:
+		return notionapi.TitleProperty{
+			Title: []notionapi.RichText{
+				{
+					Text: &notionapi.Text{
+						Content: text,
+					},
+				},
+			},
+		}, true
+	case config.PropertyTypeSelect:
+		return notionapi.SelectProperty{Select: notionapi.Option{Name: selectOptionName(text)}}, true
+	case config.PropertyTypeMultiSelect:
+		var options []notionapi.Option
+		for _, name := range strings.Split(text, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				options = append(options, notionapi.Option{Name: selectOptionName(name)})
+			}
+		}
+		return notionapi.MultiSelectProperty{MultiSelect: options}, true
+	default:
+		return richTextProperty(text), true
+	}
+}
+
+// selectOptionName makes a value usable as a select option, which cannot contain commas
+func selectOptionName(name string) string {
+	const maxOptionLength = 100
+
+	name = strings.ReplaceAll(name, ",", " ")
+	if runes := []rune(name); len(runes) > maxOptionLength {
+		name = string(runes[:maxOptionLength])
+	}
+	return name
+}
+
+// propertiesHash hashes page properties to detect when they have to be written again
+func propertiesHash(properties notionapi.Properties) string {
+	data, err := json.Marshal(properties)
+	if err != nil {
+		logger.Logger.Printf("Warning: could not hash page properties: %v\n", err)
+		return ""
+	}
+
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
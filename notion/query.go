@@ -1,9 +1,25 @@
 package notion
 
 import (
+	"kobo-to-notion/config"
+
 	"github.com/jomei/notionapi"
 )
 
+// CheckDatabase verifies the database can be read with the configured token and returns its title
+func (s *NotionService) CheckDatabase(databaseID string) (string, error) {
+	database, err := s.dbClient.Get(s.contextFunc(), notionapi.DatabaseID(databaseID))
+	if err != nil {
+		return "", err
+	}
+
+	var title string
+	for _, richText := range database.Title {
+		title += richText.PlainText
+	}
+	return title, nil
+}
+
 // GetBookmarkIDs fetches all BookmarkIDs from Notion
 func (s *NotionService) GetBookmarkIDs(databaseID string) (map[string]bool, error) {
 	existingBookmarks := make(map[string]bool)
@@ -33,8 +49,9 @@ func (s *NotionService) GetBookmarkIDs(databaseID string) (map[string]bool, erro
 
 // extractBookmarkIDs extracts bookmark IDs from query results and adds them to the map
 func (s *NotionService) extractBookmarkIDs(res *notionapi.DatabaseQueryResponse, bookmarks map[string]bool) {
+	bookmarkIDProperty, _ := s.propertyName(config.FieldBookmarkID)
 	for _, page := range res.Results {
-		if prop, ok := page.Properties[PropBookmarkID].(*notionapi.RichTextProperty); ok {
+		if prop, ok := page.Properties[bookmarkIDProperty].(*notionapi.RichTextProperty); ok {
 			for _, text := range prop.RichText {
 				bookmarks[text.PlainText] = true
 			}
@@ -42,9 +59,31 @@ func (s *NotionService) extractBookmarkIDs(res *notionapi.DatabaseQueryResponse,
 	}
 }
 
+// bookPage is a page of the database and the book title it holds
+type bookPage struct {
+	id    notionapi.PageID
+	title string
+}
+
 // GetPagesByBookName fetches pages grouped by book name
 func (s *NotionService) GetPagesByBookName(databaseID string) (map[string]notionapi.PageID, error) {
+	pages, err := s.queryBookPages(databaseID)
+	if err != nil {
+		return nil, err
+	}
+
 	bookPages := make(map[string]notionapi.PageID)
+	for _, page := range pages {
+		bookPages[page.title] = page.id
+	}
+	return bookPages, nil
+}
+
+// queryBookPages fetches the titled pages of the database in query order. Several pages
+// may hold the same title, when different books share it.
+func (s *NotionService) queryBookPages(databaseID string) ([]bookPage, error) {
+	var pages []bookPage
+	titleProperty, _ := s.propertyName(config.FieldTitle)
 	var startCursor notionapi.Cursor
 
 	for {
@@ -59,10 +98,9 @@ func (s *NotionService) GetPagesByBookName(databaseID string) (map[string]notion
 		}
 
 		for _, page := range res.Results {
-			// Extract book name from Book Title property
-			if titleProp, ok := page.Properties[PropBookTitle].(*notionapi.TitleProperty); ok && len(titleProp.Title) > 0 {
-				bookName := titleProp.Title[0].PlainText
-				bookPages[bookName] = notionapi.PageID(page.ID)
+			// Extract book name from the title property
+			if titleProp, ok := page.Properties[titleProperty].(*notionapi.TitleProperty); ok && len(titleProp.Title) > 0 {
+				pages = append(pages, bookPage{id: notionapi.PageID(page.ID), title: titleProp.Title[0].PlainText})
 			}
 		}
 
@@ -72,5 +110,5 @@ func (s *NotionService) GetPagesByBookName(databaseID string) (map[string]notion
 		startCursor = res.NextCursor
 	}
 
-	return bookPages, nil
+	return pages, nil
 }
@@ -0,0 +1,152 @@
+package notion
+
+import (
+	"fmt"
+	"kobo-to-notion/config"
+	"kobo-to-notion/logger"
+	"kobo-to-notion/state"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// deletionPolicy is what a sync does to the pages and highlights of books removed from the Kobo
+type deletionPolicy struct {
+	// policy is one of the config.DeletePolicy values
+	policy string
+	// afterMissing is how many syncs in a row a book must be missing before its page is removed
+	afterMissing int
+	// maxPercent is the largest share of the pages of the database a sync may remove
+	maxPercent int
+}
+
+// defaultDeletionPolicy archives pages and deletes highlights as soon as they are missing
+func defaultDeletionPolicy() deletionPolicy {
+	return deletionPolicy{policy: config.DeletePolicyArchive, afterMissing: 1, maxPercent: 100}
+}
+
+// RemovalLimitError aborts a sync that would remove more pages than the deletion policy allows,
+// as happens when the Kobo database read is empty or the wrong one
+type RemovalLimitError struct {
+	Removed    int
+	Total      int
+	MaxPercent int
+}
+
+func (e *RemovalLimitError) Error() string {
+	return fmt.Sprintf("%d of %d pages would be removed, more than the %d%% allowed", e.Removed, e.Total, e.MaxPercent)
+}
+
+// planMissingPage plans what happens to the page of a book missing from the Kobo. Pages are
+// kept until their book has been missing for enough syncs in a row, then archived or marked
+// as removed once. Nothing is planned for pages the policy keeps forever or already marked.
+func (s *NotionService) planMissingPage(bookName string, pageID notionapi.PageID) (PageChange, bool) {
+	if s.deletion.policy == config.DeletePolicyNever {
+		return PageChange{}, false
+	}
+
+	missing := s.store.MissingSyncs(string(pageID)) + 1
+	change := PageChange{
+		Book:         bookName,
+		PageID:       string(pageID),
+		MissingSyncs: missing,
+	}
+
+	switch {
+	case missing < s.deletion.afterMissing:
+		change.Action = PageKeep
+	case s.deletion.policy == config.DeletePolicyArchive:
+		change.Action = PageArchive
+	case missing == s.deletion.afterMissing:
+		change.Action = PageMark
+	default:
+		return PageChange{}, false
+	}
+
+	return change, true
+}
+
+// checkRemovals aborts plans removing more than the allowed share of the pages of the database
+func (s *NotionService) checkRemovals(plan *Plan, totalPages int) error {
+	removed := 0
+	for _, page := range plan.Pages {
+		if page.Action == PageArchive || page.Action == PageMark {
+			removed++
+		}
+	}
+
+	if removed > 0 && removed*100 > s.deletion.maxPercent*totalPages {
+		return &RemovalLimitError{Removed: removed, Total: totalPages, MaxPercent: s.deletion.maxPercent}
+	}
+	return nil
+}
+
+// removedBookmarkChanges plans what happens to the blocks of a bookmark removed from the Kobo
+func (s *NotionService) removedBookmarkChanges(bookmarkID string, entry state.Entry) []BlockChange {
+	switch {
+	case s.deletion.policy == config.DeletePolicyArchive:
+		return []BlockChange{{Action: BlockDelete, BookmarkID: bookmarkID, BlockIDs: entry.BlockIDs}}
+	case s.deletion.policy == config.DeletePolicyMark && !entry.Removed:
+		return []BlockChange{{Action: BlockMark, BookmarkID: bookmarkID, BlockIDs: entry.BlockIDs}}
+	default:
+		return nil
+	}
+}
+
+// markBookPage strikes through the title of a page whose book was removed from the Kobo and
+// writes when it was removed. The title is written without strike-through again if the book
+// comes back, as its properties then differ from the ones last written.
+func (s *NotionService) markBookPage(change PageChange) error {
+	values := map[string]any{
+		config.FieldTitle:   change.Book,
+		config.FieldRemoved: time.Now(),
+	}
+	properties := s.buildProperties(values, PlanModeGrouped)
+
+	titleName, _ := s.propertyName(config.FieldTitle)
+	if title, ok := properties[titleName].(notionapi.TitleProperty); ok {
+		for i := range title.Title {
+			title.Title[i].Annotations = &notionapi.Annotations{Strikethrough: true}
+		}
+	}
+
+	_, err := s.pageClient.Update(s.contextFunc(), notionapi.PageID(change.PageID), &notionapi.PageUpdateRequest{
+		Properties: properties,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.store.SetPageHash(change.PageID, propertiesHash(properties))
+	s.store.SetMissingSyncs(change.PageID, change.MissingSyncs)
+	return nil
+}
+
+// strikeBlocks strikes through the text of synced blocks, reporting whether all were updated
+func (s *NotionService) strikeBlocks(blockIDs []notionapi.BlockID) bool {
+	for _, blockID := range blockIDs {
+		block, err := s.blockClient.Get(s.contextFunc(), blockID)
+		if err != nil {
+			logger.Logger.Printf("Warning: could not read block %s: %v\n", blockID, err)
+			return false
+		}
+
+		richText, _ := blockContent(block)
+		for i := range richText {
+			if richText[i].Annotations == nil {
+				richText[i].Annotations = &notionapi.Annotations{}
+			}
+			richText[i].Annotations.Strikethrough = true
+		}
+
+		request, ok := blockUpdateRequest(block)
+		if !ok {
+			continue
+		}
+		if _, err := s.blockClient.Update(s.contextFunc(), blockID, request); err != nil {
+			logger.Logger.Printf("Warning: could not mark block %s as removed: %v\n", blockID, err)
+			return false
+		}
+	}
+	return true
+}
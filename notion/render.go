@@ -0,0 +1,253 @@
+package notion
+
+import (
+	"fmt"
+	"kobo-to-notion/config"
+	"kobo-to-notion/kobo"
+	"kobo-to-notion/utils"
+
+	"github.com/jomei/notionapi"
+)
+
+// locationLabel opens the blocks rendered for dog-ears
+const locationLabel = "Location"
+
+// Dog-ears are listed under their own heading after the highlights of a book. The
+// heading is tracked like a chapter heading, under an ID no chapter file can have.
+const (
+	dogEarSectionID    = "#dogears"
+	dogEarSectionTitle = "Bookmarked locations"
+)
+
+// BookmarkRenderer renders the blocks written for a bookmark on a book page.
+// Renderers return a single top-level block holding the rest of the bookmark,
+// so a highlight and its note are always created, moved and deleted together.
+// Every rendered block starts with the bold label telling the sync it owns it.
+type BookmarkRenderer interface {
+	// Style names the rendering, it is stored with the synced blocks
+	Style() string
+	// Render returns the blocks of a bookmark
+	Render(bookmark kobo.Bookmark) []notionapi.Block
+}
+
+// styledRenderer renders bookmarks with a block type for the top-level block and
+// another for the blocks nested in it: the rest of a long highlight and the note
+type styledRenderer struct {
+	style  string
+	block  func(bookmark kobo.Bookmark, richText []notionapi.RichText, children []notionapi.Block) notionapi.Block
+	nested func(richText []notionapi.RichText) notionapi.Block
+}
+
+// NewBookmarkRenderer returns the built-in renderer of a block style
+func NewBookmarkRenderer(style string) (BookmarkRenderer, error) {
+	switch style {
+	case config.BlockStyleQuote:
+		return &styledRenderer{style: style, block: quoteBlock, nested: nestedQuoteBlock}, nil
+	case config.BlockStyleCallout:
+		return &styledRenderer{style: style, block: calloutBlock, nested: nestedQuoteBlock}, nil
+	case config.BlockStyleToggle:
+		return &styledRenderer{style: style, block: toggleBlock, nested: nestedQuoteBlock}, nil
+	case config.BlockStyleBulleted:
+		return &styledRenderer{style: style, block: bulletedBlock, nested: nestedBulletedBlock}, nil
+	default:
+		return nil, fmt.Errorf("unknown block style %q", style)
+	}
+}
+
+// defaultRenderer renders bookmarks as quotes
+func defaultRenderer() BookmarkRenderer {
+	renderer, _ := NewBookmarkRenderer(config.BlockStyleQuote)
+	return renderer
+}
+
+// Style names the rendering
+func (r *styledRenderer) Style() string {
+	return r.style
+}
+
+// Render returns a single block opening with the highlighted text, shown on the background
+// of its colour, and the annotation nested inside it. Bookmarks without text are rendered
+// as their annotation, and dog-ears as their location.
+func (r *styledRenderer) Render(bookmark kobo.Bookmark) []notionapi.Block {
+	color, background := highlightColors(bookmark.Color)
+
+	if bookmark.IsDogEar() {
+		location := labeledRichText(locationLabel, bookmark.Location(), color, "")
+		return []notionapi.Block{r.block(bookmark, location[0], nil)}
+	}
+
+	text := labeledRichText(PropHighlightedText, bookmark.Text, color, background)
+	note := labeledRichText(PropAnnotation, bookmark.Annotation, color, "")
+	if len(text) == 0 {
+		text, note = note, nil
+	}
+	if len(text) == 0 {
+		return []notionapi.Block{}
+	}
+
+	var children []notionapi.Block
+	for _, richText := range append(text[1:], note...) {
+		children = append(children, r.nested(richText))
+	}
+
+	return []notionapi.Block{r.block(bookmark, text[0], children)}
+}
+
+// labeledRichText splits content in the rich text of consecutive blocks, each starting with
+// a bold label. Content is split in text objects of 2000 characters, and content needing more
+// text objects than a block accepts continues in further blocks carrying the same label.
+// The label is tinted with color and the content, when a background is given, shown on it.
+func labeledRichText(label string, content string, color notionapi.Color, background notionapi.Color) [][]notionapi.RichText {
+	if content == "" {
+		return nil
+	}
+
+	// Split text into chunks of 2000 characters
+	const bookMarkTextSplit = 2000
+	textChunks := utils.SplitText(content, bookMarkTextSplit)
+
+	// The label and the line break take two of the rich text objects of each block
+	const chunksPerBlock = maxRichTextPerBlock - 2
+
+	var blocks [][]notionapi.RichText
+	for start := 0; start < len(textChunks); start += chunksPerBlock {
+		end := min(start+chunksPerBlock, len(textChunks))
+
+		richText := []notionapi.RichText{
+			{
+				Type: notionapi.ObjectTypeText,
+				Text: &notionapi.Text{
+					Content: label,
+				},
+				Annotations: &notionapi.Annotations{
+					Bold:  true,
+					Color: color,
+				},
+			},
+			{
+				Type: notionapi.ObjectTypeText,
+				Text: &notionapi.Text{
+					Content: "\n",
+				},
+			},
+		}
+
+		for _, chunk := range textChunks[start:end] {
+			text := notionapi.RichText{
+				Type: notionapi.ObjectTypeText,
+				Text: &notionapi.Text{
+					Content: chunk,
+				},
+			}
+			if background != "" {
+				text.Annotations = &notionapi.Annotations{Color: background}
+			}
+			richText = append(richText, text)
+		}
+
+		blocks = append(blocks, richText)
+	}
+
+	return blocks
+}
+
+// calloutIcon returns the icon of the callout rendered for a bookmark
+func calloutIcon(bookmark kobo.Bookmark) *notionapi.Icon {
+	emoji := notionapi.Emoji("💬")
+	if color, ok := config.HighlightColorByIndex(bookmark.Color); ok {
+		emoji = notionapi.Emoji(color.Emoji)
+	}
+	return &notionapi.Icon{Type: "emoji", Emoji: &emoji}
+}
+
+func quoteBlock(_ kobo.Bookmark, richText []notionapi.RichText, children []notionapi.Block) notionapi.Block {
+	return &notionapi.QuoteBlock{
+		BasicBlock: notionapi.BasicBlock{
+			Object: notionapi.ObjectTypeBlock,
+			Type:   notionapi.BlockTypeQuote,
+		},
+		Quote: notionapi.Quote{
+			RichText: richText,
+			Children: children,
+		},
+	}
+}
+
+func nestedQuoteBlock(richText []notionapi.RichText) notionapi.Block {
+	return quoteBlock(kobo.Bookmark{}, richText, nil)
+}
+
+func calloutBlock(bookmark kobo.Bookmark, richText []notionapi.RichText, children []notionapi.Block) notionapi.Block {
+	return &notionapi.CalloutBlock{
+		BasicBlock: notionapi.BasicBlock{
+			Object: notionapi.ObjectTypeBlock,
+			Type:   notionapi.BlockTypeCallout,
+		},
+		Callout: notionapi.Callout{
+			RichText: richText,
+			Icon:     calloutIcon(bookmark),
+			Children: children,
+		},
+	}
+}
+
+func toggleBlock(_ kobo.Bookmark, richText []notionapi.RichText, children []notionapi.Block) notionapi.Block {
+	return &notionapi.ToggleBlock{
+		BasicBlock: notionapi.BasicBlock{
+			Object: notionapi.ObjectTypeBlock,
+			Type:   notionapi.BlockTypeToggle,
+		},
+		Toggle: notionapi.Toggle{
+			RichText: richText,
+			Children: children,
+		},
+	}
+}
+
+func bulletedBlock(_ kobo.Bookmark, richText []notionapi.RichText, children []notionapi.Block) notionapi.Block {
+	return &notionapi.BulletedListItemBlock{
+		BasicBlock: notionapi.BasicBlock{
+			Object: notionapi.ObjectTypeBlock,
+			Type:   notionapi.BlockTypeBulletedListItem,
+		},
+		BulletedListItem: notionapi.ListItem{
+			RichText: richText,
+			Children: children,
+		},
+	}
+}
+
+func nestedBulletedBlock(richText []notionapi.RichText) notionapi.Block {
+	return bulletedBlock(kobo.Bookmark{}, richText, nil)
+}
+
+// blockStyle returns the style of a synced top-level block, from its type
+func blockStyle(block notionapi.Block) string {
+	switch block.GetType() {
+	case notionapi.BlockTypeCallout:
+		return config.BlockStyleCallout
+	case notionapi.BlockTypeToggle:
+		return config.BlockStyleToggle
+	case notionapi.BlockTypeBulletedListItem:
+		return config.BlockStyleBulleted
+	default:
+		return config.BlockStyleQuote
+	}
+}
+
+// entryStyle returns the style of the blocks of a stored entry. Entries synced
+// before styles could be chosen hold quotes.
+func entryStyle(style string) string {
+	if style == "" {
+		return config.BlockStyleQuote
+	}
+	return style
+}
+
+// storedStyle returns the style recorded in the entries of rendered bookmarks, empty for quotes
+func storedStyle(style string) string {
+	if style == config.BlockStyleQuote {
+		return ""
+	}
+	return style
+}
@@ -0,0 +1,218 @@
+package notion
+
+import (
+	"fmt"
+	"kobo-to-notion/logger"
+	"maps"
+
+	"github.com/jomei/notionapi"
+)
+
+// schemaProperty is a database property the sync writes to
+type schemaProperty struct {
+	name       string
+	configType notionapi.PropertyConfigType
+	optional   bool
+}
+
+// SchemaIssue is a database property missing or not matching the type the sync writes
+type SchemaIssue struct {
+	Property string                       `json:"property"`
+	Expected notionapi.PropertyConfigType `json:"expected"`
+	// Actual is empty when the property is missing
+	Actual notionapi.PropertyConfigType `json:"actual,omitempty"`
+	// CurrentName is set when the title property exists under another name
+	CurrentName string `json:"current_name,omitempty"`
+	// optional is set for properties the sync can do without
+	optional bool
+}
+
+func (i SchemaIssue) String() string {
+	switch {
+	case i.CurrentName != "":
+		return fmt.Sprintf("title property is named %q instead of %q", i.CurrentName, i.Property)
+	case i.Actual == "":
+		return fmt.Sprintf("missing property %q of type %s", i.Property, i.Expected)
+	default:
+		return fmt.Sprintf("property %q is of type %s instead of %s", i.Property, i.Actual, i.Expected)
+	}
+}
+
+// fixable reports whether the issue can be fixed without changing existing values
+func (i SchemaIssue) fixable() bool {
+	return i.Actual == "" || i.CurrentName != ""
+}
+
+// schemaProperties returns the mapped properties written in a sync mode, title first
+func (s *NotionService) schemaProperties(mode string) []schemaProperty {
+	var properties []schemaProperty
+	for _, field := range s.modeFields(mode) {
+		mapping := s.properties[field]
+		properties = append(properties, schemaProperty{mapping.Name, notionapi.PropertyConfigType(mapping.Type), mapping.Optional})
+	}
+	return properties
+}
+
+// propertyConfig returns an empty property schema of the given type
+func propertyConfig(configType notionapi.PropertyConfigType) notionapi.PropertyConfig {
+	switch configType {
+	case notionapi.PropertyConfigTypeTitle:
+		return notionapi.TitlePropertyConfig{Type: configType}
+	case notionapi.PropertyConfigTypeDate:
+		return notionapi.DatePropertyConfig{Type: configType}
+	case notionapi.PropertyConfigTypeSelect:
+		return notionapi.SelectPropertyConfig{Type: configType, Select: notionapi.Select{Options: []notionapi.Option{}}}
+	case notionapi.PropertyConfigTypeMultiSelect:
+		return notionapi.MultiSelectPropertyConfig{Type: configType, MultiSelect: notionapi.Select{Options: []notionapi.Option{}}}
+	case notionapi.PropertyConfigTypeNumber:
+		return notionapi.NumberPropertyConfig{Type: configType, Number: notionapi.NumberFormat{Format: notionapi.FormatNumber}}
+	default:
+		return notionapi.RichTextPropertyConfig{Type: notionapi.PropertyConfigTypeRichText}
+	}
+}
+
+// renamePropertyConfig renames an existing property, which notionapi has no schema object for
+type renamePropertyConfig struct {
+	Name string `json:"name"`
+}
+
+func (p renamePropertyConfig) GetType() notionapi.PropertyConfigType {
+	return ""
+}
+
+func (p renamePropertyConfig) GetID() notionapi.PropertyID {
+	return ""
+}
+
+// checkSchema compares the properties of a database with the expected ones
+func checkSchema(database *notionapi.Database, properties []schemaProperty) []SchemaIssue {
+	var issues []SchemaIssue
+
+	for _, expected := range properties {
+		actual, exists := database.Properties[expected.name]
+		if exists {
+			if actual.GetType() != expected.configType {
+				issues = append(issues, SchemaIssue{Property: expected.name, Expected: expected.configType, Actual: actual.GetType()})
+			}
+			continue
+		}
+
+		issue := SchemaIssue{Property: expected.name, Expected: expected.configType, optional: expected.optional}
+
+		// Every database has a single title property, possibly under another name
+		if expected.configType == notionapi.PropertyConfigTypeTitle {
+			for name, property := range database.Properties {
+				if property.GetType() == notionapi.PropertyConfigTypeTitle {
+					issue.CurrentName = name
+					issue.Actual = notionapi.PropertyConfigTypeTitle
+				}
+			}
+		}
+
+		issues = append(issues, issue)
+	}
+
+	return issues
+}
+
+// ValidateSchema reports the properties of the database that do not match those written in a
+// sync mode. Optional properties the database lacks are not issues, see DropMissingOptionalProperties.
+func (s *NotionService) ValidateSchema(databaseID string, mode string) ([]SchemaIssue, error) {
+	database, err := s.dbClient.Get(s.contextFunc(), notionapi.DatabaseID(databaseID))
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []SchemaIssue
+	for _, issue := range checkSchema(database, s.schemaProperties(mode)) {
+		if !issue.optional || issue.Actual != "" {
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues, nil
+}
+
+// DropMissingOptionalProperties stops writing the optional properties the database lacks,
+// so databases made before they existed keep syncing
+func (s *NotionService) DropMissingOptionalProperties(databaseID string) error {
+	database, err := s.dbClient.Get(s.contextFunc(), notionapi.DatabaseID(databaseID))
+	if err != nil {
+		return err
+	}
+
+	properties := maps.Clone(s.properties)
+	for field, mapping := range s.properties {
+		if _, exists := database.Properties[mapping.Name]; mapping.Optional && !exists {
+			logger.Debugf("Database has no %q property, it is not written", mapping.Name)
+			delete(properties, field)
+		}
+	}
+	s.properties = properties
+
+	return nil
+}
+
+// FixSchema adds missing properties, optional ones included, and renames the title property
+// of the database. Properties of the wrong type are not converted, as that would change their
+// values, and are returned as the issues left to fix by hand.
+func (s *NotionService) FixSchema(databaseID string, mode string) ([]SchemaIssue, error) {
+	database, err := s.dbClient.Get(s.contextFunc(), notionapi.DatabaseID(databaseID))
+	if err != nil {
+		return nil, err
+	}
+	issues := checkSchema(database, s.schemaProperties(mode))
+
+	properties := notionapi.PropertyConfigs{}
+	var remaining []SchemaIssue
+	for _, issue := range issues {
+		switch {
+		case issue.CurrentName != "":
+			properties[issue.CurrentName] = renamePropertyConfig{Name: issue.Property}
+		case issue.fixable():
+			properties[issue.Property] = propertyConfig(issue.Expected)
+		default:
+			remaining = append(remaining, issue)
+		}
+	}
+
+	if len(properties) > 0 {
+		_, err = s.dbClient.Update(s.contextFunc(), notionapi.DatabaseID(databaseID), &notionapi.DatabaseUpdateRequest{
+			Properties: properties,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return remaining, nil
+}
+
+// CreateDatabase creates a database with the properties of a sync mode under a page and returns its ID
+func (s *NotionService) CreateDatabase(parentPageID string, title string, mode string) (string, error) {
+	properties := notionapi.PropertyConfigs{}
+	for _, property := range s.schemaProperties(mode) {
+		properties[property.name] = propertyConfig(property.configType)
+	}
+
+	database, err := s.dbClient.Create(s.contextFunc(), &notionapi.DatabaseCreateRequest{
+		Parent: notionapi.Parent{
+			Type:   notionapi.ParentTypePageID,
+			PageID: notionapi.PageID(parentPageID),
+		},
+		Title: []notionapi.RichText{
+			{
+				Type: notionapi.ObjectTypeText,
+				Text: &notionapi.Text{
+					Content: title,
+				},
+			},
+		},
+		Properties: properties,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return string(database.ID), nil
+}
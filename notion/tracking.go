@@ -0,0 +1,410 @@
+package notion
+
+import (
+	"fmt"
+	"kobo-to-notion/config"
+	"kobo-to-notion/kobo"
+	"kobo-to-notion/logger"
+	"kobo-to-notion/state"
+	"kobo-to-notion/utils"
+	"strings"
+	"time"
+
+	"github.com/jomei/notionapi"
+)
+
+// pendingBookmark tracks the blocks of a bookmark, or the heading of a chapter,
+// waiting to be appended to a page
+type pendingBookmark struct {
+	bookmarkID string
+	chapterID  string
+	hash       string
+	blockCount int
+	// keptIDs are the blocks of the bookmark already on the page, before the appended ones
+	keptIDs []string
+}
+
+// needsAdoption reports whether the page blocks have to be read to know which belong to which bookmark
+func needsAdoption(tracked map[string]state.Entry) bool {
+	if len(tracked) == 0 {
+		return true
+	}
+
+	for _, entry := range tracked {
+		if len(entry.BlockIDs) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// adoptPageBlocks rebuilds the state of a page from the synced blocks found on it.
+// Pages synced before the state store existed, or created without block IDs, are
+// matched by text, chapter headings by the IDs stored when they were written. Synced blocks matching no bookmark are returned as orphans, along
+// with the entries and the chapter headings found. They are only stored once the plan
+// using them is applied.
+func (s *NotionService) adoptPageBlocks(pageID notionapi.PageID, bookmarks []kobo.Bookmark) (map[string]state.Entry, map[string]string, []notionapi.BlockID, error) {
+	pageBlocks, err := s.getAllBlocksFromPage(pageID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	adopted := make(map[string][]notionapi.Block)
+	var orphans []notionapi.BlockID
+	for _, block := range filterSyncedBlocks(pageBlocks) {
+		bookmarkID, ok := matchSyncedBlock(block, bookmarks, adopted)
+		if !ok {
+			orphans = append(orphans, block.GetID())
+			continue
+		}
+		adopted[bookmarkID] = append(adopted[bookmarkID], block)
+	}
+
+	entries := make(map[string]state.Entry)
+	for _, bookmark := range bookmarks {
+		blocks, ok := adopted[bookmark.BookmarkID]
+		if !ok {
+			continue
+		}
+
+		entry := state.Entry{
+			PageID:   string(pageID),
+			Style:    storedStyle(blockStyle(blocks[0])),
+			SyncedAt: time.Now(),
+		}
+		for _, block := range blocks {
+			entry.BlockIDs = append(entry.BlockIDs, string(block.GetID()))
+		}
+
+		// Blocks with the expected layout are up to date, others get re-rendered
+		if sameBlockLabels(blocks, s.renderer.Render(bookmark)) {
+			entry.Hash = utils.HashBookmark(bookmark)
+		}
+
+		entries[bookmark.BookmarkID] = entry
+	}
+
+	chapters := matchChapterHeadings(pageBlocks, s.store.PageChapters(string(pageID)))
+
+	logger.Debugf("Matched synced blocks of %d bookmarks and %d chapters on page %s\n", len(entries), len(chapters), pageID)
+	return entries, chapters, orphans, nil
+}
+
+// keepTrackedBlocks gives back to their bookmarks the orphans the store already tracked,
+// such as the blocks of bookmarks removed from the Kobo or of edited highlights, so they are
+// marked, deleted or updated like any tracked block. Entries keep whether they were marked
+// as removed. The orphans no bookmark ever owned are returned.
+func keepTrackedBlocks(previous map[string]state.Entry, adopted map[string]state.Entry, orphans []notionapi.BlockID) []notionapi.BlockID {
+	owners := make(map[string]string)
+	for bookmarkID, entry := range previous {
+		if entry.Removed {
+			if adoptedEntry, ok := adopted[bookmarkID]; ok {
+				adoptedEntry.Removed = true
+				adopted[bookmarkID] = adoptedEntry
+			}
+		}
+
+		if _, ok := adopted[bookmarkID]; ok {
+			continue
+		}
+		for _, blockID := range entry.BlockIDs {
+			owners[blockID] = bookmarkID
+		}
+	}
+
+	kept := make(map[string][]string)
+	var remaining []notionapi.BlockID
+	for _, blockID := range orphans {
+		bookmarkID, ok := owners[string(blockID)]
+		if !ok {
+			remaining = append(remaining, blockID)
+			continue
+		}
+		kept[bookmarkID] = append(kept[bookmarkID], string(blockID))
+	}
+
+	for bookmarkID, blockIDs := range kept {
+		// Their text no longer matches, they are rewritten if the bookmark still exists
+		entry := previous[bookmarkID]
+		entry.BlockIDs = blockIDs
+		entry.Hash = ""
+		adopted[bookmarkID] = entry
+	}
+
+	return remaining
+}
+
+// matchChapterHeadings finds the headings written for chapters still on the page. Only
+// headings the store already tracks are matched, a heading typed by the user with the
+// title of a chapter is never taken for a synced one, and so never deleted.
+func matchChapterHeadings(blocks []notionapi.Block, known map[string]string) map[string]string {
+	onPage := make(map[string]bool)
+	for _, block := range blocks {
+		if block.GetType() == notionapi.BlockTypeHeading2 {
+			onPage[string(block.GetID())] = true
+		}
+	}
+
+	chapters := make(map[string]string)
+	for chapterID, blockID := range known {
+		if onPage[blockID] {
+			chapters[chapterID] = blockID
+		}
+	}
+
+	return chapters
+}
+
+// matchSyncedBlock finds the bookmark a synced block was rendered from
+func matchSyncedBlock(block notionapi.Block, bookmarks []kobo.Bookmark, adopted map[string][]notionapi.Block) (string, bool) {
+	label := syncedBlockLabel(block)
+	text := block.GetRichTextString()
+
+	for _, bookmark := range bookmarks {
+		content := bookmark.Text
+		switch {
+		case bookmark.IsDogEar() != (label == locationLabel):
+			continue
+		case label == PropAnnotation:
+			content = bookmark.Annotation
+		case label == locationLabel:
+			content = bookmark.Location()
+		}
+
+		if content == "" || !strings.Contains(text, content) {
+			continue
+		}
+
+		// The same text may be highlighted twice, each bookmark owns one block per label
+		taken := false
+		for _, existing := range adopted[bookmark.BookmarkID] {
+			if syncedBlockLabel(existing) == label {
+				taken = true
+				break
+			}
+		}
+
+		if !taken {
+			return bookmark.BookmarkID, true
+		}
+	}
+
+	return "", false
+}
+
+// sameBlockLabels reports whether existing synced blocks have the layout and type of the rendered ones
+func sameBlockLabels(existing []notionapi.Block, rendered []notionapi.Block) bool {
+	if len(existing) != len(rendered) {
+		return false
+	}
+
+	for i := range existing {
+		if existing[i].GetType() != rendered[i].GetType() || syncedBlockLabel(existing[i]) != syncedBlockLabel(rendered[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// canUpdateInPlace reports whether existing blocks can take the content of rendered ones
+func canUpdateInPlace(blocks []notionapi.Block) bool {
+	for _, block := range blocks {
+		if _, ok := blockUpdateRequest(block); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// updateBlocksInPlace replaces the content of existing blocks, keeping their position and comments
+func (s *NotionService) updateBlocksInPlace(blockIDs []string, blocks []notionapi.Block) bool {
+	if len(blockIDs) != len(blocks) {
+		return false
+	}
+
+	for i, block := range blocks {
+		if err := s.updateBlock(notionapi.BlockID(blockIDs[i]), block); err != nil {
+			logger.Logger.Printf("Warning: could not update block %s: %v\n", blockIDs[i], err)
+			return false
+		}
+	}
+
+	return true
+}
+
+// updateBlock replaces the content of an existing block and of its synced children. Children
+// are matched by position: missing ones are appended and extra ones deleted, while children
+// added by the user are left untouched.
+func (s *NotionService) updateBlock(blockID notionapi.BlockID, block notionapi.Block) error {
+	request, ok := blockUpdateRequest(block)
+	if !ok {
+		return fmt.Errorf("block type %s cannot be updated", block.GetType())
+	}
+
+	updated, err := s.blockClient.Update(s.contextFunc(), blockID, request)
+	if err != nil {
+		return err
+	}
+
+	children := blockChildren(block)
+	if len(children) == 0 && (updated == nil || !updated.GetHasChildren()) {
+		return nil
+	}
+
+	existing, err := s.getChildBlocks(blockID)
+	if err != nil {
+		return err
+	}
+	existing = filterSyncedBlocks(existing)
+
+	kept := min(len(existing), len(children))
+	for i := range kept {
+		if err := s.updateBlock(existing[i].GetID(), children[i]); err != nil {
+			return err
+		}
+	}
+
+	if len(children) > kept {
+		if _, err := s.appendBlocks(blockID, "", children[kept:]); err != nil {
+			return err
+		}
+	}
+
+	var surplus []notionapi.BlockID
+	for _, child := range existing[kept:] {
+		surplus = append(surplus, child.GetID())
+	}
+	s.deleteBlocks(surplus)
+
+	return nil
+}
+
+// deleteBlocks removes blocks from a page and returns how many were deleted
+func (s *NotionService) deleteBlocks(blockIDs []notionapi.BlockID) int {
+	deleted := 0
+	for _, blockID := range blockIDs {
+		_, err := s.blockClient.Delete(s.contextFunc(), blockID)
+		if err != nil {
+			logger.Logger.Printf("Warning: could not delete block %s: %v\n", blockID, err)
+			continue
+		}
+
+		logger.Debugf("Deleted block %s", blockID)
+		deleted++
+	}
+	return deleted
+}
+
+// recordAppendedBlocks stores the blocks created for each pending bookmark. When the
+// created blocks are unknown the entries are stored without IDs and adopted next run.
+func (s *NotionService) recordAppendedBlocks(pageID notionapi.PageID, pending []pendingBookmark, created []notionapi.Block) {
+	total := 0
+	for _, p := range pending {
+		total += p.blockCount
+	}
+
+	offset := 0
+	for _, p := range pending {
+		if p.chapterID != "" {
+			if len(created) == total {
+				s.store.SetChapter(string(pageID), p.chapterID, string(created[offset].GetID()))
+			}
+			offset += p.blockCount
+			continue
+		}
+
+		entry := state.Entry{
+			PageID:   string(pageID),
+			Hash:     p.hash,
+			Style:    storedStyle(s.renderer.Style()),
+			SyncedAt: time.Now(),
+		}
+
+		if len(created) == total {
+			entry.BlockIDs = append(entry.BlockIDs, p.keptIDs...)
+			for _, block := range created[offset : offset+p.blockCount] {
+				entry.BlockIDs = append(entry.BlockIDs, string(block.GetID()))
+			}
+		}
+		offset += p.blockCount
+
+		s.store.Set(p.bookmarkID, entry)
+	}
+}
+
+// toBlockIDs converts stored block IDs to Notion block IDs
+func toBlockIDs(ids []string) []notionapi.BlockID {
+	blockIDs := make([]notionapi.BlockID, 0, len(ids))
+	for _, id := range ids {
+		blockIDs = append(blockIDs, notionapi.BlockID(id))
+	}
+	return blockIDs
+}
+
+// pagesWithRemovedBookmarks returns the pages holding tracked bookmarks that are no longer on the
+// Kobo and still have to be deleted or marked as removed
+func (s *NotionService) pagesWithRemovedBookmarks(bookmarks []kobo.Bookmark) map[notionapi.PageID]bool {
+	pages := make(map[notionapi.PageID]bool)
+	if s.deletion.policy == config.DeletePolicyNever {
+		return pages
+	}
+
+	current := make(map[string]bool)
+	for _, bookmark := range bookmarks {
+		current[bookmark.BookmarkID] = true
+	}
+
+	for bookmarkID, entry := range s.store.Bookmarks {
+		if !current[bookmarkID] && !entry.Removed {
+			pages[notionapi.PageID(entry.PageID)] = true
+		}
+	}
+	return pages
+}
+
+// bookChanged reports whether a book has bookmarks created, modified or removed since the last sync
+func (s *NotionService) bookChanged(bookmarks []kobo.Bookmark, hasRemovals bool) bool {
+	if hasRemovals || s.store.Watermark.IsZero() {
+		return true
+	}
+
+	for _, bookmark := range bookmarks {
+		// Bookmarks marked as removed came back
+		if entry, tracked := s.store.Get(bookmark.BookmarkID); !tracked || entry.Removed {
+			return true
+		}
+
+		modified, err := utils.ParseKoboBookmarkDate(bookmark.DateModified)
+		if err != nil || modified.After(s.store.Watermark) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// advanceWatermark moves the watermark to the latest bookmark modification
+func (s *NotionService) advanceWatermark(bookmarks []kobo.Bookmark) {
+	for _, bookmark := range bookmarks {
+		modified, err := utils.ParseKoboBookmarkDate(bookmark.DateModified)
+		if err != nil {
+			continue
+		}
+
+		if modified.After(s.store.Watermark) {
+			s.store.Watermark = modified
+		}
+	}
+}
+
+// fromBlockIDs converts Notion block IDs to stored block IDs
+func fromBlockIDs(blockIDs []notionapi.BlockID) []string {
+	ids := make([]string, 0, len(blockIDs))
+	for _, blockID := range blockIDs {
+		ids = append(ids, string(blockID))
+	}
+	return ids
+}
@@ -0,0 +1,236 @@
+package notion
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults following https://developers.notion.com/reference/request-limits
+const (
+	DefaultMinRequestInterval = time.Second / 3
+	DefaultMaxRetries         = 5
+	DefaultRetryBaseDelay     = 500 * time.Millisecond
+	DefaultRetryMaxDelay      = 30 * time.Second
+)
+
+// RetryTransport is an http.RoundTripper that keeps requests under the Notion rate
+// limit and retries rate limited or failed requests with jittered exponential backoff.
+// Requests answered with 429 were not processed and are always retried, server errors
+// and network failures are only retried for idempotent requests.
+type RetryTransport struct {
+	Base        http.RoundTripper
+	MinInterval time.Duration
+	MaxRetries  int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+
+	mu          sync.Mutex
+	nextRequest time.Time
+	requests    int
+	retries     int
+	failures    map[string]int
+}
+
+// NewRetryTransport wraps a transport with the default Notion limits
+func NewRetryTransport(base http.RoundTripper) *RetryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &RetryTransport{
+		Base:        base,
+		MinInterval: DefaultMinRequestInterval,
+		MaxRetries:  DefaultMaxRetries,
+		BaseDelay:   DefaultRetryBaseDelay,
+		MaxDelay:    DefaultRetryMaxDelay,
+		failures:    make(map[string]int),
+	}
+}
+
+// RoundTrip sends the request, waiting for the rate limit and retrying when allowed
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if err := t.waitTurn(req.Context()); err != nil {
+			return nil, err
+		}
+
+		attemptReq, err := rewindRequest(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.Base.RoundTrip(attemptReq)
+
+		retry, delay := t.retryDelay(req, resp, err, attempt)
+		if !retry || attempt >= t.MaxRetries {
+			t.recordResult(resp, err)
+			return resp, err
+		}
+
+		// The response is discarded, release the connection before retrying
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		t.mu.Lock()
+		t.retries++
+		t.mu.Unlock()
+
+		if err := sleepContext(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Summary describes the requests sent so far, including the ones that failed after all retries
+func (t *RetryTransport) Summary() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	failed := 0
+	var reasons []string
+	for reason, count := range t.failures {
+		failed += count
+		reasons = append(reasons, fmt.Sprintf("%s: %d", reason, count))
+	}
+	sort.Strings(reasons)
+
+	summary := fmt.Sprintf("%d Notion requests, %d retries, %d failed", t.requests, t.retries, failed)
+	if len(reasons) > 0 {
+		summary += " (" + strings.Join(reasons, ", ") + ")"
+	}
+	return summary
+}
+
+// waitTurn blocks until the next request fits in the rate limit
+func (t *RetryTransport) waitTurn(ctx context.Context) error {
+	t.mu.Lock()
+	now := time.Now()
+	wait := t.nextRequest.Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	t.nextRequest = now.Add(wait + t.MinInterval)
+	t.requests++
+	t.mu.Unlock()
+
+	return sleepContext(ctx, wait)
+}
+
+// retryDelay decides whether an attempt is retried and how long to wait before it
+func (t *RetryTransport) retryDelay(req *http.Request, resp *http.Response, err error, attempt int) (bool, time.Duration) {
+	if err != nil {
+		return isIdempotent(req), t.backoff(attempt)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		if delay, ok := retryAfter(resp); ok {
+			return true, delay
+		}
+		return true, t.backoff(attempt)
+	case resp.StatusCode == http.StatusConflict || resp.StatusCode >= http.StatusInternalServerError:
+		return isIdempotent(req), t.backoff(attempt)
+	default:
+		return false, 0
+	}
+}
+
+// backoff returns the jittered exponential delay of an attempt
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	delay := t.BaseDelay << attempt
+	if delay <= 0 || delay > t.MaxDelay {
+		delay = t.MaxDelay
+	}
+
+	// Jitter between half and the full delay so parallel clients do not retry together
+	half := delay / 2
+	if half <= 0 {
+		return delay
+	}
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// recordResult counts requests that still failed after all retries
+func (t *RetryTransport) recordResult(resp *http.Response, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch {
+	case err != nil:
+		t.failures["network error"]++
+	case resp.StatusCode >= http.StatusBadRequest:
+		t.failures[strconv.Itoa(resp.StatusCode)]++
+	}
+}
+
+// isIdempotent reports whether a request can be sent twice without side effects.
+// Database queries and searches are POST requests but only read data, and appending
+// block children is a PATCH request that adds the blocks again each time it is sent.
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete:
+		return true
+	case http.MethodPatch:
+		return !strings.HasSuffix(req.URL.Path, "/children")
+	case http.MethodPost:
+		return strings.HasSuffix(req.URL.Path, "/query") || strings.HasSuffix(req.URL.Path, "/search")
+	default:
+		return false
+	}
+}
+
+// retryAfter reads the delay requested by Notion in the Retry-After header
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// rewindRequest returns the request to send for an attempt, with a fresh body on retries
+func rewindRequest(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 0 || req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("cannot retry %s %s: request body is not replayable", req.Method, req.URL.Path)
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+
+	retryReq := req.Clone(req.Context())
+	retryReq.Body = body
+	return retryReq, nil
+}
+
+// sleepContext waits for the given duration unless the context is done first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
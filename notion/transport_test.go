@@ -0,0 +1,158 @@
+package notion_test
+
+import (
+	"io"
+	"kobo-to-notion/notion"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestTransport creates a RetryTransport without rate limit and with short delays
+func newTestTransport() *notion.RetryTransport {
+	transport := notion.NewRetryTransport(nil)
+	transport.MinInterval = 0
+	transport.BaseDelay = time.Millisecond
+	transport.MaxDelay = 5 * time.Millisecond
+	transport.MaxRetries = 3
+	return transport
+}
+
+func TestRetryTransportRetriesRateLimited(t *testing.T) {
+	var calls int32
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+
+		if atomic.AddInt32(&calls, 1) <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	transport := newTestTransport()
+	client := &http.Client{Transport: transport}
+
+	// Page creation is not idempotent, but rate limited requests were never processed
+	resp, err := client.Post(server.URL+"/v1/pages", "application/json", strings.NewReader(`{"a":1}`))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	assert.Equal(t, []string{`{"a":1}`, `{"a":1}`, `{"a":1}`}, bodies, "Every attempt should send the full body")
+	assert.Equal(t, "3 Notion requests, 2 retries, 0 failed", transport.Summary())
+}
+
+func TestRetryTransportRetriesIdempotentServerErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newTestTransport()}
+
+	resp, err := client.Get(server.URL + "/v1/blocks/block-id/children")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestRetryTransportDoesNotRetryNonIdempotentServerErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	transport := newTestTransport()
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Post(server.URL+"/v1/pages", "application/json", strings.NewReader(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "Page creation must not be sent twice")
+	assert.Equal(t, "1 Notion requests, 0 retries, 1 failed (500: 1)", transport.Summary())
+}
+
+func TestRetryTransportDoesNotRetryAppendServerErrors(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newTestTransport()}
+
+	// The blocks may have been appended before the error, sending them again duplicates them
+	req, err := http.NewRequest(http.MethodPatch, server.URL+"/v1/blocks/page-id/children", strings.NewReader(`{}`))
+	assert.NoError(t, err)
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "Appending children must not be sent twice")
+
+	// Other updates set the same values each time they are sent
+	req, err = http.NewRequest(http.MethodPatch, server.URL+"/v1/blocks/block-id", strings.NewReader(`{}`))
+	assert.NoError(t, err)
+	atomic.StoreInt32(&calls, 0)
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestRetryTransportGivesUpAfterMaxRetries(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	transport := newTestTransport()
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Post(server.URL+"/v1/databases/db-id/query", "application/json", strings.NewReader(`{}`))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls), "Database queries should be retried up to MaxRetries")
+	assert.Contains(t, transport.Summary(), "503: 1")
+}
+
+func TestRetryTransportRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	transport := newTestTransport()
+	transport.MinInterval = 20 * time.Millisecond
+	client := &http.Client{Transport: transport}
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(server.URL)
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	assert.GreaterOrEqual(t, time.Since(start), 40*time.Millisecond, "Requests should be spaced by MinInterval")
+}
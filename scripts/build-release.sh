@@ -47,12 +47,14 @@ ASSETS_PATH="$BASE_PATH/../assets"
 DOCKER_IMAGE_NAME="arm-go-builder:latest"
 BINARY_NAME="sync.arm"
 RELEASE_ZIP="release.zip"
+VERSION=$(git describe --tags --always 2>/dev/null || echo dev)
 
 echo Base path: $BASE_PATH
 echo Temp folder: $TEMP_FOLDER
 echo Docker image name: $DOCKER_IMAGE_NAME
 echo Binary name: $BINARY_NAME
 echo Release zip: $RELEASE_ZIP
+echo Version: $VERSION
 
 # Function to clean up temporary resources
 cleanup() {
@@ -85,7 +87,7 @@ docker build -t $DOCKER_IMAGE_NAME .
 
 # Compile the binary for ARM
 echo "Compiling binary for ARM (This may take a while)"
-docker run --rm -it -v $(pwd):/app $DOCKER_IMAGE_NAME bash -c "CC=arm-linux-gnueabi-gcc CGO_ENABLED=1 GOOS=linux GOARCH=arm GOARM=7 go build -trimpath -ldflags '-extldflags -static' -o $BINARY_NAME"
+docker run --rm -it -v $(pwd):/app $DOCKER_IMAGE_NAME bash -c "CC=arm-linux-gnueabi-gcc CGO_ENABLED=1 GOOS=linux GOARCH=arm GOARM=7 go build -trimpath -ldflags '-extldflags -static -X kobo-to-notion/cli.Version=$VERSION' -o $BINARY_NAME"
 
 # Move the compiled binary to the release directory
 echo "Moving compiled binary to release directory..."
@@ -0,0 +1,211 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Entry records where a bookmark was synced to in Notion. Style is the block style
+// its blocks were rendered with, empty for quotes. Removed is set once the blocks of
+// a bookmark removed from the Kobo are marked as such.
+type Entry struct {
+	PageID   string    `json:"page_id"`
+	BlockIDs []string  `json:"block_ids,omitempty"`
+	Hash     string    `json:"hash"`
+	Style    string    `json:"style,omitempty"`
+	Removed  bool      `json:"removed,omitempty"`
+	SyncedAt time.Time `json:"synced_at"`
+}
+
+// Store keeps the sync state between runs, keyed by Kobo BookmarkID
+type Store struct {
+	path      string
+	Bookmarks map[string]Entry `json:"bookmarks"`
+	// Watermark is the latest bookmark modification date included in a successful sync
+	Watermark time.Time `json:"watermark,omitempty"`
+	// LastSync is when the last sync without failed pages was applied
+	LastSync time.Time `json:"last_sync,omitempty"`
+	// Pages holds the hash of the properties last written to each page, keyed by page ID
+	Pages map[string]string `json:"pages,omitempty"`
+	// Chapters holds the block ID of the heading written for each chapter, keyed by page ID then chapter ContentID
+	Chapters map[string]map[string]string `json:"chapters,omitempty"`
+	// Missing counts the syncs in a row the book of each page was missing from the Kobo, keyed by page ID
+	Missing map[string]int `json:"missing,omitempty"`
+	// Books holds the page synced for each book, keyed by Kobo VolumeID
+	Books map[string]string `json:"books,omitempty"`
+}
+
+// New creates an empty in-memory store, Save is a no-op on it
+func New() *Store {
+	return &Store{
+		Bookmarks: make(map[string]Entry),
+		Pages:     make(map[string]string),
+		Chapters:  make(map[string]map[string]string),
+		Missing:   make(map[string]int),
+		Books:     make(map[string]string),
+	}
+}
+
+// Load reads the store from a JSON file, a missing file yields an empty store
+func Load(path string) (*Store, error) {
+	store := New()
+	store.path = path
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, err
+	}
+
+	if store.Bookmarks == nil {
+		store.Bookmarks = make(map[string]Entry)
+	}
+	if store.Pages == nil {
+		store.Pages = make(map[string]string)
+	}
+	if store.Chapters == nil {
+		store.Chapters = make(map[string]map[string]string)
+	}
+	if store.Missing == nil {
+		store.Missing = make(map[string]int)
+	}
+	if store.Books == nil {
+		store.Books = make(map[string]string)
+	}
+
+	return store, nil
+}
+
+// Save writes the store back to the file it was loaded from
+func (s *Store) Save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so an interrupted sync never leaves a truncated state
+	tmpPath := s.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, s.path)
+}
+
+// Get returns the entry for a bookmark
+func (s *Store) Get(bookmarkID string) (Entry, bool) {
+	entry, ok := s.Bookmarks[bookmarkID]
+	return entry, ok
+}
+
+// Set records the entry for a bookmark
+func (s *Store) Set(bookmarkID string, entry Entry) {
+	s.Bookmarks[bookmarkID] = entry
+}
+
+// Delete forgets a bookmark
+func (s *Store) Delete(bookmarkID string) {
+	delete(s.Bookmarks, bookmarkID)
+}
+
+// PageEntries returns the entries of all bookmarks synced to a page
+func (s *Store) PageEntries(pageID string) map[string]Entry {
+	entries := make(map[string]Entry)
+	for bookmarkID, entry := range s.Bookmarks {
+		if entry.PageID == pageID {
+			entries[bookmarkID] = entry
+		}
+	}
+	return entries
+}
+
+// PageHash returns the hash of the properties last written to a page
+func (s *Store) PageHash(pageID string) string {
+	return s.Pages[pageID]
+}
+
+// SetPageHash records the hash of the properties written to a page
+func (s *Store) SetPageHash(pageID string, hash string) {
+	s.Pages[pageID] = hash
+}
+
+// DeletePage forgets a page and the bookmarks synced to it
+func (s *Store) DeletePage(pageID string) {
+	for bookmarkID := range s.PageEntries(pageID) {
+		delete(s.Bookmarks, bookmarkID)
+	}
+	delete(s.Pages, pageID)
+	delete(s.Chapters, pageID)
+	delete(s.Missing, pageID)
+	for volumeID, bookPageID := range s.Books {
+		if bookPageID == pageID {
+			delete(s.Books, volumeID)
+		}
+	}
+}
+
+// BookPage returns the page synced for a book, empty when unknown
+func (s *Store) BookPage(volumeID string) string {
+	return s.Books[volumeID]
+}
+
+// SetBookPage records the page synced for a book
+func (s *Store) SetBookPage(volumeID string, pageID string) {
+	s.Books[volumeID] = pageID
+}
+
+// MissingSyncs returns how many syncs in a row the book of a page was missing from the Kobo
+func (s *Store) MissingSyncs(pageID string) int {
+	return s.Missing[pageID]
+}
+
+// SetMissingSyncs records how many syncs in a row the book of a page was missing, zero once found
+func (s *Store) SetMissingSyncs(pageID string, syncs int) {
+	if syncs == 0 {
+		delete(s.Missing, pageID)
+		return
+	}
+	s.Missing[pageID] = syncs
+}
+
+// PageChapters returns the heading block of each chapter written to a page
+func (s *Store) PageChapters(pageID string) map[string]string {
+	chapters := make(map[string]string)
+	for chapterID, blockID := range s.Chapters[pageID] {
+		chapters[chapterID] = blockID
+	}
+	return chapters
+}
+
+// SetChapter records the heading block written for a chapter on a page
+func (s *Store) SetChapter(pageID string, chapterID string, blockID string) {
+	if s.Chapters[pageID] == nil {
+		s.Chapters[pageID] = make(map[string]string)
+	}
+	s.Chapters[pageID][chapterID] = blockID
+}
+
+// DeleteChapter forgets the heading of a chapter on a page
+func (s *Store) DeleteChapter(pageID string, chapterID string) {
+	delete(s.Chapters[pageID], chapterID)
+	if len(s.Chapters[pageID]) == 0 {
+		delete(s.Chapters, pageID)
+	}
+}
@@ -0,0 +1,160 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadMissingFile(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "state_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	store, err := Load(filepath.Join(tempDir, "sync_state.json"))
+	if err != nil {
+		t.Fatalf("Load failed for missing file: %v", err)
+	}
+
+	if len(store.Bookmarks) != 0 {
+		t.Errorf("Expected empty store, got %d entries", len(store.Bookmarks))
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "state_test")
+	if err != nil {
+		t.Fatalf("Failed to create temp directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	path := filepath.Join(tempDir, "nested", "sync_state.json")
+
+	store, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	syncedAt := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	store.Set("bm1", Entry{PageID: "page1", BlockIDs: []string{"block1", "block2"}, Hash: "hash1", SyncedAt: syncedAt})
+	store.Set("bm2", Entry{PageID: "page2", Hash: "hash2", SyncedAt: syncedAt})
+
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed after save: %v", err)
+	}
+
+	entry, ok := loaded.Get("bm1")
+	if !ok {
+		t.Fatal("Expected bm1 to be in the loaded store")
+	}
+	if entry.PageID != "page1" || entry.Hash != "hash1" || len(entry.BlockIDs) != 2 {
+		t.Errorf("Unexpected entry after reload: %+v", entry)
+	}
+	if !entry.SyncedAt.Equal(syncedAt) {
+		t.Errorf("SyncedAt = %v; want %v", entry.SyncedAt, syncedAt)
+	}
+
+	loaded.Delete("bm1")
+	if _, ok := loaded.Get("bm1"); ok {
+		t.Error("Expected bm1 to be deleted")
+	}
+}
+
+func TestPageEntries(t *testing.T) {
+	store := New()
+	store.Set("bm1", Entry{PageID: "page1"})
+	store.Set("bm2", Entry{PageID: "page1"})
+	store.Set("bm3", Entry{PageID: "page2"})
+
+	entries := store.PageEntries("page1")
+	if len(entries) != 2 {
+		t.Errorf("Expected 2 entries for page1, got %d", len(entries))
+	}
+	if _, ok := entries["bm3"]; ok {
+		t.Error("bm3 belongs to page2 and should not be returned")
+	}
+}
+
+func TestSaveInMemoryStore(t *testing.T) {
+	store := New()
+	store.Set("bm1", Entry{PageID: "page1"})
+
+	if err := store.Save(); err != nil {
+		t.Errorf("Save on an in-memory store should be a no-op, got %v", err)
+	}
+}
+
+func TestDeletePage(t *testing.T) {
+	store := New()
+	store.Set("bm1", Entry{PageID: "page1"})
+	store.Set("bm2", Entry{PageID: "page2"})
+	store.SetPageHash("page1", "hash1")
+	store.SetChapter("page1", "ch1", "heading1")
+	store.SetBookPage("volume1", "page1")
+	store.SetBookPage("volume2", "page2")
+
+	store.DeletePage("page1")
+
+	if _, ok := store.Get("bm1"); ok {
+		t.Error("bm1 belongs to the deleted page and should be forgotten")
+	}
+	if _, ok := store.Get("bm2"); !ok {
+		t.Error("bm2 belongs to page2 and should be kept")
+	}
+	if hash := store.PageHash("page1"); hash != "" {
+		t.Errorf("Expected no hash for the deleted page, got %q", hash)
+	}
+	if chapters := store.PageChapters("page1"); len(chapters) != 0 {
+		t.Errorf("Expected no chapters for the deleted page, got %v", chapters)
+	}
+	if pageID := store.BookPage("volume1"); pageID != "" {
+		t.Errorf("Expected no page for the book of the deleted page, got %q", pageID)
+	}
+	if pageID := store.BookPage("volume2"); pageID != "page2" {
+		t.Errorf("Expected the page of volume2 to be kept, got %q", pageID)
+	}
+}
+
+func TestChapters(t *testing.T) {
+	store := New()
+	store.SetChapter("page1", "ch1", "heading1")
+	store.SetChapter("page1", "ch2", "heading2")
+	store.SetChapter("page2", "ch1", "heading3")
+
+	store.DeleteChapter("page1", "ch2")
+
+	chapters := store.PageChapters("page1")
+	if len(chapters) != 1 || chapters["ch1"] != "heading1" {
+		t.Errorf("Expected only the ch1 heading on page1, got %v", chapters)
+	}
+	if chapters := store.PageChapters("page2"); chapters["ch1"] != "heading3" {
+		t.Errorf("Expected the ch1 heading of page2 to be kept, got %v", chapters)
+	}
+}
+
+func TestMissingSyncs(t *testing.T) {
+	store := New()
+	store.SetMissingSyncs("page1", 2)
+	store.SetMissingSyncs("page2", 1)
+	store.SetMissingSyncs("page2", 0)
+
+	if syncs := store.MissingSyncs("page1"); syncs != 2 {
+		t.Errorf("Expected page1 missing for 2 syncs, got %d", syncs)
+	}
+	if _, ok := store.Missing["page2"]; ok {
+		t.Error("page2 was found again and should be forgotten")
+	}
+
+	store.DeletePage("page1")
+	if syncs := store.MissingSyncs("page1"); syncs != 0 {
+		t.Errorf("Expected no missing syncs for the deleted page, got %d", syncs)
+	}
+}
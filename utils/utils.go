@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"kobo-to-notion/kobo"
 	"path/filepath"
@@ -18,6 +20,21 @@ func GetBookNameFromVolumeID(volumeID string) string {
 	return bookName
 }
 
+// Returns the book title from the Kobo content table, falling back to the VolumeID file name
+func GetBookName(bookmark kobo.Bookmark) string {
+	book := bookmark.Book
+	book.VolumeID = bookmark.VolumeID
+	return GetBookTitle(book)
+}
+
+// Returns the title of a book, falling back to its VolumeID file name
+func GetBookTitle(book kobo.Book) string {
+	if title := strings.TrimSpace(book.Title); title != "" {
+		return title
+	}
+	return GetBookNameFromVolumeID(book.VolumeID)
+}
+
 // Filters bookmarks to only keep new ones
 func FilterNewBookmarks(bookmarks []kobo.Bookmark, existingBookmarks map[string]bool) []kobo.Bookmark {
 	var newBookmarks []kobo.Bookmark
@@ -29,6 +46,16 @@ func FilterNewBookmarks(bookmarks []kobo.Bookmark, existingBookmarks map[string]
 	return newBookmarks
 }
 
+// Hashes the bookmark content rendered to Notion, used to detect edited highlights
+func HashBookmark(bookmark kobo.Bookmark) string {
+	hash := sha256.New()
+	for _, field := range []string{bookmark.Text, bookmark.Annotation, bookmark.Color} {
+		hash.Write([]byte(field))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
 func ParseKoboBookmarkDate(dateStr string) (time.Time, error) {
 	if dateStr == "" {
 		return time.Time{}, errors.New("empty date string")
@@ -25,6 +25,24 @@ func TestGetBookNameFromVolumeID(t *testing.T) {
 	}
 }
 
+func TestGetBookName(t *testing.T) {
+	tests := []struct {
+		bookmark kobo.Bookmark
+		expected string
+	}{
+		{kobo.Bookmark{VolumeID: "file:///mnt/onboard/my_book_v2.epub", Book: kobo.Book{Title: "My Book"}}, "My Book"},
+		{kobo.Bookmark{VolumeID: "file:///mnt/onboard/my_book_v2.epub"}, "my_book_v2"},
+		{kobo.Bookmark{VolumeID: "file:///mnt/onboard/my_book_v2.epub", Book: kobo.Book{Title: "  "}}, "my_book_v2"},
+	}
+
+	for _, test := range tests {
+		result := GetBookName(test.bookmark)
+		if result != test.expected {
+			t.Errorf("GetBookName(%+v) = %q; want %q", test.bookmark, result, test.expected)
+		}
+	}
+}
+
 func TestFilterNewBookmarks(t *testing.T) {
 	bookmarks := []kobo.Bookmark{
 		{BookmarkID: "1"},
@@ -54,6 +72,26 @@ func TestFilterNewBookmarks(t *testing.T) {
 	}
 }
 
+func TestHashBookmark(t *testing.T) {
+	bookmark := kobo.Bookmark{BookmarkID: "1", Text: "Some text", Annotation: "A note", Color: "1"}
+
+	if HashBookmark(bookmark) != HashBookmark(bookmark) {
+		t.Error("HashBookmark should be stable for the same bookmark")
+	}
+
+	edited := bookmark
+	edited.Annotation = "An edited note"
+	if HashBookmark(bookmark) == HashBookmark(edited) {
+		t.Error("HashBookmark should change when the annotation changes")
+	}
+
+	// Field boundaries must be part of the hash
+	shifted := kobo.Bookmark{Text: "Some textA note", Color: "1"}
+	if HashBookmark(bookmark) == HashBookmark(shifted) {
+		t.Error("HashBookmark should not collide when content moves between fields")
+	}
+}
+
 func TestParseKoboBookmarkDate(t *testing.T) {
 	tests := []struct {
 		dateStr  string